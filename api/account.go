@@ -0,0 +1,155 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// inverterPageSize is the number of inverters requested in each page of the
+// account's inverters.
+const inverterPageSize = 100
+
+// InverterInfo describes an inverter on the SunSynk account.
+type InverterInfo struct {
+	SN         string `json:"sn"`
+	Model      string `json:"model"`
+	RatedPower int    `json:"rated_power"`
+	Firmware   string `json:"firmware"`
+	Plant      string `json:"plant"`
+	Online     bool   `json:"online"`
+}
+
+// envelope is the wrapper around every response from the SunSynk API.
+type envelope struct {
+	Code    int             `json:"code"`
+	Msg     string          `json:"msg"`
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do sends a request to the SunSynk API and decodes the data in the response.
+func do(ctx context.Context, method string, u string, token string, body any, data any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	_, err := call(ctx, func(ctx context.Context) (any, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, r)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var e envelope
+		if err = json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s: %w", resp.Status, err)
+		}
+		if !e.Success {
+			return nil, fmt.Errorf("%s (code %d)", e.Msg, e.Code)
+		}
+		return nil, json.Unmarshal(e.Data, data)
+	})
+	return err
+}
+
+// tokenKey is the context key of a string that the SunSynk API's access token is
+// copied to when synkctl authenticates.
+type tokenKey struct{}
+
+// ListInverters authenticates with the SunSynk API and returns all the inverters
+// on the account, not just the default inverter in the synkctl config file. The
+// access token that synkctl obtains is used to list the inverters so the
+// connection must have been configured with ConfigureConnection.
+func ListInverters(ctx context.Context) ([]InverterInfo, error) {
+	var token string
+	if err := NewInverter("").Authenticate(context.WithValue(ctx, tokenKey{}, &token)); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, errors.New("can't authenticate: no access token")
+	}
+	cfg, err := readConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+
+	infos := []InverterInfo{}
+	for page := 1; ; page++ {
+		var data struct {
+			Total int `json:"total"`
+			Infos []struct {
+				SN         string  `json:"sn"`
+				Model      string  `json:"model"`
+				Status     int     `json:"status"`
+				RatedPower float64 `json:"ratePower"`
+				Version    struct {
+					MasterVer string `json:"masterVer"`
+					SoftVer   string `json:"softVer"`
+				} `json:"version"`
+				Plant struct {
+					Name string `json:"name"`
+				} `json:"plant"`
+			} `json:"infos"`
+		}
+		q := url.Values{}
+		q.Set("page", fmt.Sprint(page))
+		q.Set("limit", fmt.Sprint(inverterPageSize))
+		q.Set("type", "-1")
+		q.Set("status", "-1")
+		if err = do(ctx, http.MethodGet, endpoint+"/api/v1/inverters?"+q.Encode(), token, nil, &data); err != nil {
+			return nil, err
+		}
+		for _, i := range data.Infos {
+			firmware := i.Version.MasterVer
+			if i.Version.SoftVer != "" {
+				firmware = strings.TrimPrefix(firmware+"/"+i.Version.SoftVer, "/")
+			}
+			infos = append(infos, InverterInfo{
+				SN:         i.SN,
+				Model:      i.Model,
+				RatedPower: int(i.RatedPower),
+				Firmware:   firmware,
+				Plant:      i.Plant.Name,
+				Online:     i.Status == 1,
+			})
+		}
+		if len(data.Infos) == 0 || len(infos) >= data.Total {
+			return infos, nil
+		}
+	}
+}
@@ -21,57 +21,210 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"math/rand"
-	"os"
+	"net/url"
 	"sync"
 	"time"
 
+	"github.com/hammingweight/gnomon/credentials"
+	"github.com/hammingweight/gnomon/journal"
+	"github.com/hammingweight/gnomon/notify"
 	"github.com/hammingweight/synkctl/configuration"
 	"github.com/hammingweight/synkctl/rest"
 )
 
+// client holds the settings that are shared by all inverters.
 type client struct {
-	mutex      sync.Mutex
-	client     *rest.SynkClient
-	configFile string
+	mutex       sync.Mutex
+	configFile  string
+	credentials credentials.Provider
+	location    *time.Location
+	baseURL     string
+	// host is the host of the SunSynk API that was last read from the configuration.
+	host    string
+	timeout time.Duration
 }
 
 var c client
 
-func authenticate(ctx context.Context) {
+// Inverter reads the state and settings of one inverter and updates its settings
+// using the SunSynk API or, if one is set, a backend.
+type Inverter struct {
+	mutex        sync.Mutex
+	sn           string
+	client       *rest.SynkClient
+	backend      Backend
+	journal      *journal.File
+	observers    []*observer
+	changes      chan change
+	startManager sync.Once
+}
+
+// NewInverter returns an Inverter for the inverter with the serial number sn. The
+// default inverter in the synkctl config file is used if sn is empty.
+func NewInverter(sn string) *Inverter {
+	return &Inverter{sn: sn, changes: make(chan change)}
+}
+
+// SN returns the inverter's serial number. If no serial number was given to
+// NewInverter, it is empty until the inverter has authenticated with the SunSynk API.
+func (inv *Inverter) SN() string {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	return inv.sn
+}
+
+// notifyFor sends a notification that names the inverter with the serial number sn
+// if the serial number is known.
+func notifyFor(sn string, event string, format string, args ...any) {
+	if sn != "" {
+		format = "Inverter " + sn + ": " + format
+	}
+	notify.Notify(event, format, args...)
+}
+
+// authFailuresBeforeNotifying is the number of consecutive failures to
+// authenticate before a notification is sent.
+const authFailuresBeforeNotifying = 3
+
+// pollFailuresBeforeNotifying is the number of consecutive failures to
+// read the inverter's state before a notification is sent.
+const pollFailuresBeforeNotifying = 10
+
+// readConfiguration reads the synkctl config file and replaces the endpoint with
+// the configured base URL and the credentials with those supplied by the
+// credentials provider, if there are any.
+func readConfiguration(ctx context.Context) (*configuration.Configuration, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	cfg, err := configuration.ReadConfigurationFromFile(c.configFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.baseURL != "" {
+		cfg.Endpoint = c.baseURL
+	}
+	if u, err := url.Parse(cfg.Endpoint); err == nil {
+		c.host = u.Host
+	}
+	if c.credentials == nil {
+		return cfg, nil
+	}
+	creds, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't read credentials: %w", err)
+	}
+	if creds.User != "" {
+		cfg.User = creds.User
+	}
+	if creds.Password != "" {
+		cfg.Password = creds.Password
+	}
+	return cfg, nil
+}
 
+// login authenticates with the SunSynk API, retrying until it succeeds or the
+// context is done. An error is returned if the configuration or credentials can't
+// be read. The caller must hold inv.mutex.
+func (inv *Inverter) login(ctx context.Context) error {
+	if inv.backend != nil {
+		return nil
+	}
 	log.Println("Authenticating")
-	cfg, err := configuration.ReadConfigurationFromFile(c.configFile)
+	cfg, err := readConfiguration(ctx)
 	if err != nil {
-		log.Println("Error authenticating: ", err)
-		os.Exit(1)
+		return err
 	}
-	for {
+	if inv.sn == "" {
+		inv.sn = cfg.DefaultInverterSN
+	} else {
+		cfg.DefaultInverterSN = inv.sn
+	}
+	for attempts := 1; ; attempts++ {
 		if ctx.Err() != nil {
-			return
+			return ctx.Err()
 		}
-		client, err := rest.Authenticate(ctx, cfg)
+		client, err := call(ctx, func(ctx context.Context) (*rest.SynkClient, error) {
+			return rest.Authenticate(ctx, cfg)
+		})
 		if err == nil {
-			c.client = client
-			return
+			inv.client = client
+			return nil
 		}
 		log.Println("Failed to authenticate: ", err)
+		if attempts == authFailuresBeforeNotifying {
+			notifyFor(inv.sn, notify.AuthenticationFailed, "Failed to authenticate %d times: %s", attempts, err)
+		}
 		time.Sleep(30 * time.Second)
 	}
 }
 
-// ReadState reads the current state of the inverter. The state must
-// be passed as a pointer; the reference state will be updated if the
-// SunSynk API returns fresh data. This function returns false if the
-// state is unchanged.
-func ReadState(ctx context.Context, s *State) (bool, error) {
+// checkPermission sends a notification if an update was rejected because the
+// SunSynk account lacks permission to change the inverter's settings. The caller
+// must hold inv.mutex.
+func (inv *Inverter) checkPermission(err error) error {
+	if errors.Is(err, ErrPermissionDenied) {
+		notifyFor(inv.sn, notify.PermissionDenied, "Updating the inverter's settings was denied: %s", err)
+	}
+	return err
+}
+
+// SetConfigFile sets the path of the synkctl config file that holds the endpoint
+// of the SunSynk API and, if there is no credentials provider, the credentials.
+func SetConfigFile(configFile string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.configFile = configFile
+}
+
+// Authenticate authenticates with the SunSynk API using the endpoint in the
+// synkctl config file and the credentials from the credentials provider or, if
+// there is no provider, from the config file.
+func (inv *Inverter) Authenticate(ctx context.Context) error {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	return inv.login(ctx)
+}
+
+// SetCredentialsProvider sets the provider of the credentials used to authenticate
+// with the SunSynk API. The credentials in the synkctl config file are used if the
+// provider is nil.
+func SetCredentialsProvider(p credentials.Provider) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.credentials = p
+}
+
+// SetLocation sets the timezone used to interpret the times reported by
+// the inverter. The local timezone is used if no location is set.
+func SetLocation(loc *time.Location) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.location = loc
+}
+
+// location returns the timezone set by SetLocation.
+func location() *time.Location {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	return c.location
+}
+
+// ReadState reads the current state of the inverter. The state must
+// be passed as a pointer; the reference state will be updated if the
+// SunSynk API (or backend) returns fresh data. This function returns false
+// if the state is unchanged.
+func (inv *Inverter) ReadState(ctx context.Context, s *State) (bool, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if inv.backend != nil {
+		return inv.readBackendState(ctx, s)
+	}
 
-	input, err := c.client.Input(ctx)
+	input, err := call(ctx, inv.client.Input)
 	if err != nil {
 		return false, err
 	}
@@ -87,12 +240,31 @@ func ReadState(ctx context.Context, s *State) (bool, error) {
 	if !ok {
 		return false, errors.New("can't read update time")
 	}
-	updateTime := t.(string)
-	if s.Time == updateTime {
+	loc := location()
+	if loc == nil {
+		loc = time.Local
+	}
+	updateTime, err := time.ParseInLocation(time.DateTime, t.(string), loc)
+	if err != nil {
+		return false, fmt.Errorf("can't parse update time: %w", err)
+	}
+	if s.Time.Equal(updateTime) {
 		return false, nil
 	}
 
-	bat, err := c.client.Battery(ctx)
+	s.PV = []MPPT{}
+	for i := 0; ; i++ {
+		pv, ok := input.PV(i)
+		if !ok {
+			break
+		}
+		p, _ := toFloat(pv["ppv"])
+		v, _ := toFloat(pv["vpv"])
+		s.PV = append(s.PV, MPPT{Power: int(p), Voltage: v})
+	}
+	s.InverterTemperature = floatValue(input, "temp")
+
+	bat, err := call(ctx, inv.client.Battery)
 	if err != nil {
 		return false, err
 	}
@@ -100,8 +272,11 @@ func ReadState(ctx context.Context, s *State) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	s.BatteryPower = intValue(bat, "power")
+	s.BatteryVoltage = floatValue(bat, "voltage")
+	s.BatteryTemperature = floatValue(bat, "temp")
 
-	load, err := c.client.Load(ctx)
+	load, err := call(ctx, inv.client.Load)
 	if err != nil {
 		return false, err
 	}
@@ -110,22 +285,50 @@ func ReadState(ctx context.Context, s *State) (bool, error) {
 		return false, err
 	}
 
+	// The grid readings are best-effort; they're reported as zero if they can't be read.
+	s.GridPower = 0
+	s.GridVoltage = 0
+	grid, err := call(ctx, inv.client.Grid)
+	if err != nil {
+		log.Println("Can't read the grid's state:", err)
+	} else {
+		s.GridPower = intValue(grid, "pac")
+		if vip, ok := grid.Get("vip"); ok {
+			if phases, ok := vip.([]any); ok && len(phases) > 0 {
+				if phase, ok := phases[0].(map[string]any); ok {
+					s.GridVoltage, _ = toFloat(phase["volt"])
+				}
+			}
+		}
+	}
+
 	s.Time = updateTime
 	return true, nil
 }
 
-// Poll polls the SunSynk API and sends changes to the channel passed
-// as an argument.
-func Poll(ctx context.Context, configFile string, ch chan State) {
+// Poll polls the SunSynk API (or backend) and sends changes to the channel passed
+// as an argument. If the inverter's data is older than staleLimit, the
+// stale state is also sent (at most every five minutes) so that handlers
+// can stop acting on old readings; a staleLimit of zero disables the check.
+func (inv *Inverter) Poll(ctx context.Context, staleLimit time.Duration, ch chan State) {
 	defer log.Println("Finished polling inverter state")
 	reauthFlag := true
-	c.configFile = configFile
 	s := &State{}
 	delay := 15 * time.Second
 	firstChange := true
+	firstReading := true
+	var lastStaleReport time.Time
+	failures := 0
 	for {
 		if reauthFlag {
-			authenticate(ctx)
+			if err := inv.Authenticate(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Println("Error authenticating: ", err)
+				time.Sleep(30 * time.Second)
+				continue
+			}
 			firstChange = true
 		} else {
 			select {
@@ -135,8 +338,12 @@ func Poll(ctx context.Context, configFile string, ch chan State) {
 			}
 		}
 		reauthFlag = false
-		changed, err := ReadState(ctx, s)
+		changed, err := inv.ReadState(ctx, s)
 		if err != nil {
+			failures++
+			if failures == pollFailuresBeforeNotifying {
+				notifyFor(inv.SN(), notify.APIFailures, "Failed to read the inverter's state %d times in a row: %s", failures, err)
+			}
 			// Only reauth for 20% of the errors
 			if rand.Intn(5) == 0 {
 				reauthFlag = true
@@ -145,119 +352,157 @@ func Poll(ctx context.Context, configFile string, ch chan State) {
 			}
 			continue
 		}
+		failures = 0
 		delay = 15 * time.Second
 		if changed {
+			if firstReading && !s.plausibleAge() {
+				log.Printf("Warning: the inverter's data is %s old; check that --timezone matches the inverter's timezone\n", s.Age().Round(time.Second))
+			}
+			firstReading = false
 			ch <- *s
 			if !firstChange {
-				delay = 5 * time.Minute
+				delay = inv.pollInterval()
 			}
 			firstChange = false
+		} else if !s.Time.IsZero() && s.Stale(staleLimit) && time.Since(lastStaleReport) >= 5*time.Minute {
+			log.Printf("Inverter data is stale; last update was %s ago\n", s.Age().Round(time.Second))
+			lastStaleReport = time.Now()
+			ch <- *s
 		}
 	}
 }
 
-// UpdateBatteryCapacity sets the battery's depth of discharge before
-// the inverter will switch to grid power.
-func UpdateBatteryCapacity(cap int) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	ctx := context.Background()
-
-	inv, err := c.client.Inverter(ctx)
-	if err != nil {
-		return err
-	}
-	inv.SetBatteryCapacity(cap)
-	return c.client.UpdateInverter(ctx, inv)
-}
-
-// UpdateEssentialOnly sets whether the inverter should power all circuits (true)
-// or should power all loads (false).
-func UpdateEssentialOnly(eo bool) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	ctx := context.Background()
-
-	inv, err := c.client.Inverter(ctx)
-	if err != nil {
-		return err
-	}
-	inv.SetEssentialOnly(eo)
-	return c.client.UpdateInverter(ctx, inv)
-}
-
 // InverterRatedPower returns the rated power of the inverter.
-func InverterRatedPower(ctx context.Context) (int, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+func (inv *Inverter) InverterRatedPower(ctx context.Context) (int, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
 
+	if inv.backend != nil {
+		power, err := call(ctx, inv.backend.RatedPower)
+		if err == nil {
+			inv.notifyObservers(Read, RatedPowerSetting, power)
+		}
+		return power, err
+	}
 	for {
 		if ctx.Err() != nil {
 			return 0, ctx.Err()
 		}
-		details, err := c.client.Details(ctx)
+		details, err := call(ctx, inv.client.Details)
 		if err != nil {
-			authenticate(ctx)
+			if err = inv.login(ctx); err != nil {
+				return 0, err
+			}
 			continue
 		}
-		return details.RatedPower()
+		power, err := details.RatedPower()
+		if err == nil {
+			inv.notifyObservers(Read, RatedPowerSetting, power)
+		}
+		return power, err
 	}
 }
 
 // BatteryDischargeThreshold returns the percentage SoC of the battery at
 // which the inverter will use the grid rather than the battery to power
 // the loads.
-func BatteryDischargeThreshold(ctx context.Context) (int, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+func (inv *Inverter) BatteryDischargeThreshold(ctx context.Context) (int, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if inv.backend != nil {
+		settings, err := call(ctx, inv.backend.Settings)
+		if err != nil {
+			return 0, err
+		}
+		inv.notifyObservers(Read, BatteryCapacitySetting, settings.BatteryCapacity)
+		return settings.BatteryCapacity, nil
+	}
 
 	for {
 		if ctx.Err() != nil {
 			return 0, ctx.Err()
 		}
-		inv, err := c.client.Inverter(ctx)
+		settings, err := call(ctx, inv.client.Inverter)
 		if err != nil {
-			authenticate(ctx)
+			if err = inv.login(ctx); err != nil {
+				return 0, err
+			}
 			continue
 		}
-		return inv.BatteryCapacity()
+		capacity, err := settings.BatteryCapacity()
+		if err == nil {
+			inv.notifyObservers(Read, BatteryCapacitySetting, capacity)
+		}
+		return capacity, err
 	}
 }
 
 // EssentialOnly returns true if the inverter should power only the essential
-// circuits and returns false if the inverter should power all loads.
-func EssentialOnly(ctx context.Context) bool {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+// circuits and returns false if the inverter should power all loads. It fails safe
+// by returning true if the setting can't be read.
+func (inv *Inverter) EssentialOnly(ctx context.Context) bool {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if inv.backend != nil {
+		settings, err := call(ctx, inv.backend.Settings)
+		if err != nil {
+			log.Println("Failed to read inverter settings: ", err)
+			return true
+		}
+		inv.notifyObservers(Read, EssentialOnlySetting, settings.EssentialOnly)
+		return settings.EssentialOnly
+	}
 
 	for {
 		if ctx.Err() != nil {
 			return true
 		}
-		inv, err := c.client.Inverter(ctx)
+		settings, err := call(ctx, inv.client.Inverter)
 		if err != nil {
-			authenticate(ctx)
+			if err = inv.login(ctx); err != nil {
+				log.Println("Error authenticating: ", err)
+				return true
+			}
 			continue
 		}
-		return inv.EssentialOnly()
+		eo := settings.EssentialOnly()
+		inv.notifyObservers(Read, EssentialOnlySetting, eo)
+		return eo
 	}
 }
 
 // LowBatteryCapacity returns the SoC that generates a low
 // battery capacity alarm.
-func LowBatteryCapacity(ctx context.Context) (int, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+func (inv *Inverter) LowBatteryCapacity(ctx context.Context) (int, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if inv.backend != nil {
+		settings, err := call(ctx, inv.backend.Settings)
+		if err != nil {
+			return 0, err
+		}
+		inv.notifyObservers(Read, LowBatteryCapacitySetting, settings.LowBatteryCapacity)
+		return settings.LowBatteryCapacity, nil
+	}
 
 	for {
 		if ctx.Err() != nil {
 			return 0, ctx.Err()
 		}
-		inverter, err := c.client.Inverter(ctx)
+		inverter, err := call(ctx, inv.client.Inverter)
 		if err != nil {
-			authenticate(ctx)
+			if err = inv.login(ctx); err != nil {
+				return 0, err
+			}
 			continue
 		}
-		return inverter.BatteryLowCapacity()
+		capacity, err := inverter.BatteryLowCapacity()
+		if err == nil {
+			inv.notifyObservers(Read, LowBatteryCapacitySetting, capacity)
+		}
+		return capacity, err
 	}
 }
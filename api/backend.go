@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// localPollInterval is how often a local backend is polled for the inverter's state.
+const localPollInterval = time.Minute
+
+// Settings are the inverter settings that gnomon reads.
+type Settings struct {
+	BatteryCapacity    int
+	LowBatteryCapacity int
+	EssentialOnly      bool
+}
+
+// Update holds changes to the inverter's settings; nil fields are unchanged.
+type Update struct {
+	BatteryCapacity *int
+	EssentialOnly   *bool
+}
+
+// Backend communicates with the inverter without using the SunSynk API, e.g. over
+// Modbus. The SunSynk API is used if no backend is set.
+type Backend interface {
+	// ReadState reads the inverter's current state.
+	ReadState(ctx context.Context) (State, error)
+	// Settings reads the inverter's settings.
+	Settings(ctx context.Context) (Settings, error)
+	// UpdateSettings writes changes to the inverter's settings.
+	UpdateSettings(ctx context.Context, u Update) error
+	// RatedPower reads the inverter's rated power in watts.
+	RatedPower(ctx context.Context) (int, error)
+}
+
+// SetBackend sets the backend used to communicate with the inverter instead of
+// the SunSynk API.
+func (inv *Inverter) SetBackend(b Backend) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.backend = b
+}
+
+// readBackendState reads the state from the backend. Local backends report the
+// inverter's live readings, so the state is timestamped when it is read. The
+// caller must hold inv.mutex.
+func (inv *Inverter) readBackendState(ctx context.Context, s *State) (bool, error) {
+	state, err := call(ctx, inv.backend.ReadState)
+	if err != nil {
+		return false, err
+	}
+	if state.Time.IsZero() {
+		state.Time = time.Now().Truncate(time.Second)
+	}
+	if s.Time.Equal(state.Time) {
+		return false, nil
+	}
+	*s = state
+	return true, nil
+}
+
+// pollInterval is the time between polls once the inverter's state has changed.
+func (inv *Inverter) pollInterval() time.Duration {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	if inv.backend != nil {
+		return localPollInterval
+	}
+	return 5 * time.Minute
+}
@@ -0,0 +1,41 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// brokenBackend is a backend that can't reach the inverter.
+type brokenBackend struct{}
+
+func (brokenBackend) ReadState(context.Context) (api.State, error) {
+	return api.State{}, errors.New("no response")
+}
+
+func (brokenBackend) Settings(context.Context) (api.Settings, error) {
+	return api.Settings{}, errors.New("no response")
+}
+
+func (brokenBackend) UpdateSettings(context.Context, api.Update) error {
+	return errors.New("no response")
+}
+
+func (brokenBackend) RatedPower(context.Context) (int, error) {
+	return 0, errors.New("no response")
+}
+
+func TestEssentialOnlyFailsSafe(t *testing.T) {
+	inv := api.NewInverter("2102190001")
+	inv.SetBackend(brokenBackend{})
+	start := time.Now()
+	if !inv.EssentialOnly(context.Background()) {
+		t.Error("expected only the essential loads to be powered if the settings can't be read")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected EssentialOnly to return at once, took %s", d)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVHeader is the header of a CSV file of states. The PV columns hold the
+// values for each MPPT separated by semicolons.
+var CSVHeader = []string{
+	"time", "power", "soc", "load", "grid_power", "grid_voltage", "battery_power",
+	"battery_voltage", "battery_temperature", "inverter_temperature", "pv_power", "pv_voltage",
+}
+
+// CSVRecord returns the state as a CSV record with the columns in CSVHeader.
+func (s State) CSVRecord() []string {
+	ftoa := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	pvPower := []string{}
+	pvVoltage := []string{}
+	for _, pv := range s.PV {
+		pvPower = append(pvPower, strconv.Itoa(pv.Power))
+		pvVoltage = append(pvVoltage, ftoa(pv.Voltage))
+	}
+	return []string{
+		s.Time.Format(time.RFC3339),
+		strconv.Itoa(s.Power),
+		strconv.Itoa(s.Soc),
+		strconv.Itoa(s.Load),
+		strconv.Itoa(s.GridPower),
+		ftoa(s.GridVoltage),
+		strconv.Itoa(s.BatteryPower),
+		ftoa(s.BatteryVoltage),
+		ftoa(s.BatteryTemperature),
+		ftoa(s.InverterTemperature),
+		strings.Join(pvPower, ";"),
+		strings.Join(pvVoltage, ";"),
+	}
+}
+
+func parseState(columns map[string]int, record []string) (State, error) {
+	s := State{}
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	atoi := func(name string) (int, error) {
+		v := field(name)
+		if v == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		return int(f), err
+	}
+	atof := func(name string) (float64, error) {
+		v := field(name)
+		if v == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+
+	var err error
+	if s.Time, err = time.Parse(time.RFC3339, field("time")); err != nil {
+		return s, err
+	}
+	for _, v := range []struct {
+		name string
+		p    *int
+	}{{"power", &s.Power}, {"soc", &s.Soc}, {"load", &s.Load}, {"grid_power", &s.GridPower}, {"battery_power", &s.BatteryPower}} {
+		if *v.p, err = atoi(v.name); err != nil {
+			return s, err
+		}
+	}
+	for _, v := range []struct {
+		name string
+		p    *float64
+	}{{"grid_voltage", &s.GridVoltage}, {"battery_voltage", &s.BatteryVoltage}, {"battery_temperature", &s.BatteryTemperature}, {"inverter_temperature", &s.InverterTemperature}} {
+		if *v.p, err = atof(v.name); err != nil {
+			return s, err
+		}
+	}
+
+	s.PV = []MPPT{}
+	if field("pv_power") != "" {
+		powers := strings.Split(field("pv_power"), ";")
+		voltages := strings.Split(field("pv_voltage"), ";")
+		for i, p := range powers {
+			pv := MPPT{}
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return s, err
+			}
+			pv.Power = int(f)
+			if i < len(voltages) && voltages[i] != "" {
+				if pv.Voltage, err = strconv.ParseFloat(voltages[i], 64); err != nil {
+					return s, err
+				}
+			}
+			s.PV = append(s.PV, pv)
+		}
+	}
+	return s, nil
+}
+
+// ReadCSV reads states from CSV data with a header row. The columns are named as in
+// CSVHeader; only the time column is mandatory and missing values are zero.
+func ReadCSV(r io.Reader) ([]State, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["time"]; !ok {
+		return nil, errors.New("CSV data has no time column")
+	}
+
+	states := []State{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return states, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, err := parseState(columns, record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		states = append(states, s)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"slices"
+	"time"
+)
+
+// Operations on the inverter's settings.
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// Names of the inverter's settings.
+const (
+	BatteryCapacitySetting    = "battery_capacity"
+	EssentialOnlySetting      = "essential_only"
+	LowBatteryCapacitySetting = "low_battery_capacity"
+	RatedPowerSetting         = "rated_power"
+)
+
+// SettingEvent describes a successful read or write of one of an inverter's settings.
+type SettingEvent struct {
+	Time      time.Time `json:"time"`
+	Inverter  string    `json:"inverter,omitempty"`
+	Operation string    `json:"operation"`
+	Setting   string    `json:"setting"`
+	Value     any       `json:"value"`
+}
+
+// observer is a function registered with ObserveSettings.
+type observer struct {
+	f func(SettingEvent)
+}
+
+// ObserveSettings registers a function that is called whenever one of the inverter's
+// settings is read or written. The function is called synchronously so it must not
+// call any of the inverter's methods. The returned function unregisters f.
+func (inv *Inverter) ObserveSettings(f func(SettingEvent)) func() {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	o := &observer{f}
+	inv.observers = append(inv.observers, o)
+	return func() {
+		inv.mutex.Lock()
+		defer inv.mutex.Unlock()
+		inv.observers = slices.DeleteFunc(inv.observers, func(x *observer) bool { return x == o })
+	}
+}
+
+// notifyObservers calls the observers with an event. The caller must hold inv.mutex.
+func (inv *Inverter) notifyObservers(operation string, setting string, value any) {
+	e := SettingEvent{time.Now(), inv.sn, operation, setting, value}
+	for _, o := range inv.observers {
+		o.f(e)
+	}
+}
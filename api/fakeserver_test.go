@@ -0,0 +1,190 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/fakeserver"
+)
+
+// serve starts the fake server, points the api package's synkctl config file at it
+// and configures the connection as gnomon does.
+func serve(t *testing.T, s *fakeserver.Server) {
+	t.Helper()
+	transport := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+	if err := api.ConfigureConnection(config.API{}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	configFile := filepath.Join(t.TempDir(), "synkctl.yaml")
+	config := "user: carl\npassword: secret\nendpoint: " + srv.URL + "\ndefault_inverter_sn: " + fakeserver.DefaultSN + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	api.SetConfigFile(configFile)
+}
+
+func TestPoll(t *testing.T) {
+	s := fakeserver.New("carl", "secret")
+	serve(t, s)
+	now := time.Now().Truncate(time.Second)
+	state := api.State{Power: 1200, Soc: 73, Load: 600, GridVoltage: 231, GridPower: 50, PV: []api.MPPT{{Power: 1200, Voltage: 310}}, Time: now}
+	if err := s.SetState(fakeserver.DefaultSN, state); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan api.State, 1)
+	go api.NewInverter("").Poll(ctx, 0, ch)
+	select {
+	case <-ctx.Done():
+		t.Fatal("expected a state to be polled")
+	case got := <-ch:
+		if got.Soc != 73 {
+			t.Errorf("expected %d, got %d", 73, got.Soc)
+		}
+		if got.Power != 1200 {
+			t.Errorf("expected %d, got %d", 1200, got.Power)
+		}
+		if got.GridVoltage != 231 {
+			t.Errorf("expected %f, got %f", 231.0, got.GridVoltage)
+		}
+		if len(got.PV) != 1 || got.PV[0].Voltage != 310 {
+			t.Errorf("expected one MPPT at 310V, got %v", got.PV)
+		}
+		if !got.Time.Equal(now) {
+			t.Errorf("expected %s, got %s", now, got.Time)
+		}
+	}
+}
+
+func TestPollWithoutGrid(t *testing.T) {
+	s := fakeserver.New("carl", "secret")
+	serve(t, s)
+	s.Inject(fakeserver.Fault{Kind: fakeserver.ServerError, Endpoint: fakeserver.GridEndpoint})
+
+	// The grid's readings are best-effort so a failure doesn't stop the polling.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan api.State, 1)
+	go api.NewInverter("").Poll(ctx, 0, ch)
+	select {
+	case <-ctx.Done():
+		t.Fatal("expected a state to be polled")
+	case got := <-ch:
+		if got.Soc != 60 {
+			t.Errorf("expected %d, got %d", 60, got.Soc)
+		}
+		if got.GridVoltage != 0 || got.GridPower != 0 {
+			t.Errorf("expected no grid readings, got %fV and %dW", got.GridVoltage, got.GridPower)
+		}
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	s := fakeserver.New("carl", "secret")
+	serve(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inv := api.NewInverter("")
+	if err := inv.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if inv.SN() != fakeserver.DefaultSN {
+		t.Errorf("expected %s, got %s", fakeserver.DefaultSN, inv.SN())
+	}
+
+	// Once the access token is revoked, the inverter must authenticate again.
+	s.RevokeTokens()
+	threshold, err := inv.BatteryDischargeThreshold(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold != 40 {
+		t.Errorf("expected %d, got %d", 40, threshold)
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	s := fakeserver.New("carl", "secret")
+	serve(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inv := api.NewInverter(fakeserver.DefaultSN)
+	if err := inv.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events := []api.SettingEvent{}
+	unregister := inv.ObserveSettings(func(e api.SettingEvent) {
+		if e.Operation == api.Write {
+			events = append(events, e)
+		}
+	})
+	if err := inv.UpdateBatteryCapacity(35); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.UpdateEssentialOnly(false); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := s.Settings(fakeserver.DefaultSN)
+	if v := settings["batteryCap"]; v != "35" {
+		t.Errorf("expected %q, got %v", "35", v)
+	}
+	if v := settings["sysWorkMode"]; v != "2" {
+		t.Errorf("expected %q, got %v", "2", v)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected %d, got %d", 2, len(events))
+	}
+
+	// An unregistered observer isn't told about later writes.
+	unregister()
+	if err := inv.UpdateBatteryCapacity(30); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected %d, got %d", 2, len(events))
+	}
+}
+
+func TestListInverters(t *testing.T) {
+	// The inverters are listed 100 at a time so 150 inverters span two pages.
+	sns := []string{}
+	for i := 0; i < 150; i++ {
+		sns = append(sns, fmt.Sprintf("2102%06d", i))
+	}
+	serve(t, fakeserver.New("carl", "secret", sns...))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	infos, err := api.ListInverters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(sns) {
+		t.Fatalf("expected %d, got %d", len(sns), len(infos))
+	}
+	for i, info := range infos {
+		if info.SN != sns[i] {
+			t.Errorf("expected %s, got %s", sns[i], info.SN)
+		}
+	}
+	last := infos[len(infos)-1]
+	if last.RatedPower != 5000 || last.Model != "SUN-5K-SG01LP1" || last.Firmware != "3.3.8.9" || last.Plant != "Fake plant" || !last.Online {
+		t.Errorf("unexpected inverter %+v", last)
+	}
+}
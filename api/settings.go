@@ -0,0 +1,186 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hammingweight/gnomon/journal"
+)
+
+// batchDelay is how long the settings manager waits for further changes before
+// writing them to the inverter in a single update.
+const batchDelay = time.Second
+
+// writeTimeout bounds the time taken to read, update and verify the inverter's
+// settings.
+const writeTimeout = time.Minute
+
+// ErrNotVerified is returned if a backend's settings don't have the requested
+// values when they are read back after an update.
+var ErrNotVerified = errors.New("inverter settings don't match the requested values")
+
+// change is a request to change one or more of the inverter's settings. The outcome
+// of the update is sent to the result channel.
+type change struct {
+	batteryCapacity *int
+	essentialOnly   *bool
+	result          chan error
+}
+
+// manageSettings owns all writes to an inverter's settings. Since the SunSynk API
+// only allows all of the settings to be written at once, concurrent read-modify-write
+// updates by different handlers could lose each other's changes. Changes that arrive
+// within batchDelay of each other are merged into a single update.
+func (inv *Inverter) manageSettings() {
+	for ch := range inv.changes {
+		batch := []change{ch}
+		timer := time.After(batchDelay)
+	L:
+		for {
+			select {
+			case ch := <-inv.changes:
+				batch = append(batch, ch)
+			case <-timer:
+				break L
+			}
+		}
+		if len(batch) > 1 {
+			log.Printf("Writing %d changes to the inverter's settings in one update\n", len(batch))
+		}
+		err := inv.writeSettings(batch)
+		for _, ch := range batch {
+			ch.result <- err
+		}
+	}
+}
+
+// writeSettings writes a batch of changes to the inverter. If a setting is changed
+// more than once in a batch, the latest change wins. The SunSynk API keeps reporting
+// the old values for several minutes after an update, so changes written using the
+// API aren't read back; changes written using a backend are verified immediately.
+func (inv *Inverter) writeSettings(batch []change) error {
+	var capacity *int
+	var eo *bool
+	for _, ch := range batch {
+		if ch.batteryCapacity != nil {
+			capacity = ch.batteryCapacity
+		}
+		if ch.essentialOnly != nil {
+			eo = ch.essentialOnly
+		}
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	if inv.backend != nil {
+		return inv.writeBackendSettings(ctx, capacity, eo)
+	}
+
+	settings, err := call(ctx, inv.client.Inverter)
+	if err != nil {
+		return err
+	}
+	if capacity != nil {
+		settings.SetBatteryCapacity(*capacity)
+	}
+	if eo != nil {
+		settings.SetEssentialOnly(*eo)
+	}
+	_, err = call(ctx, func(ctx context.Context) (any, error) {
+		return nil, inv.client.UpdateInverter(ctx, settings)
+	})
+	if err != nil {
+		return inv.checkPermission(err)
+	}
+	inv.recordWrites(capacity, eo)
+	return nil
+}
+
+// writeBackendSettings writes a batch of changes using the backend and reads the
+// settings back to verify them. The caller must hold inv.mutex.
+func (inv *Inverter) writeBackendSettings(ctx context.Context, capacity *int, eo *bool) error {
+	_, err := call(ctx, func(ctx context.Context) (any, error) {
+		return nil, inv.backend.UpdateSettings(ctx, Update{BatteryCapacity: capacity, EssentialOnly: eo})
+	})
+	if err != nil {
+		return err
+	}
+	inv.recordWrites(capacity, eo)
+	settings, err := call(ctx, inv.backend.Settings)
+	if err != nil {
+		return fmt.Errorf("can't verify inverter settings: %w", err)
+	}
+	if (capacity != nil && settings.BatteryCapacity != *capacity) || (eo != nil && settings.EssentialOnly != *eo) {
+		return ErrNotVerified
+	}
+	return nil
+}
+
+// recordWrites notifies observers of, and journals, changes that were written.
+// The caller must hold inv.mutex.
+func (inv *Inverter) recordWrites(capacity *int, eo *bool) {
+	if capacity != nil {
+		inv.notifyObservers(Write, BatteryCapacitySetting, *capacity)
+		if err := inv.journal.RecordBatteryCapacity(*capacity); err != nil {
+			log.Println("Failed to update journal: ", err)
+		}
+	}
+	if eo != nil {
+		inv.notifyObservers(Write, EssentialOnlySetting, *eo)
+		if err := inv.journal.RecordEssentialOnly(*eo); err != nil {
+			log.Println("Failed to update journal: ", err)
+		}
+	}
+}
+
+// SetJournal sets the journal that records the changes made to the inverter's
+// settings; no changes are journalled if f is nil.
+func (inv *Inverter) SetJournal(f *journal.File) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.journal = f
+}
+
+// submit passes a change to the inverter's settings manager and waits for the outcome.
+func (inv *Inverter) submit(ch change) error {
+	inv.startManager.Do(func() { go inv.manageSettings() })
+	ch.result = make(chan error, 1)
+	inv.changes <- ch
+	return <-ch.result
+}
+
+// UpdateBatteryCapacity sets the battery's depth of discharge before
+// the inverter will switch to grid power. ErrNotVerified is returned if
+// a backend doesn't report the new value after the update.
+func (inv *Inverter) UpdateBatteryCapacity(cap int) error {
+	return inv.submit(change{batteryCapacity: &cap})
+}
+
+// UpdateEssentialOnly sets whether the inverter should power all circuits (true)
+// or should power all loads (false). ErrNotVerified is returned if a backend
+// doesn't report the new value after the update.
+func (inv *Inverter) UpdateEssentialOnly(eo bool) error {
+	return inv.submit(change{essentialOnly: &eo})
+}
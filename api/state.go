@@ -16,17 +16,93 @@ limitations under the License.
 
 package api
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MPPT holds the readings for one of the inverter's MPPT (PV) inputs.
+type MPPT struct {
+	Power   int     `json:"power"`
+	Voltage float64 `json:"voltage"`
+}
 
 // State represents the state of the inverter: input power, battery SoC, load power and the
 // time at which the measurements were taken.
+//
+// GridPower is positive when power is imported from the grid and negative when power is
+// exported. BatteryPower is positive when the battery is discharging and negative when the
+// battery is charging. Voltages are in volts and temperatures in degrees Celsius.
 type State struct {
-	Power int
-	Soc   int
-	Load  int
-	Time  string
+	Power               int       `json:"power"`
+	Soc                 int       `json:"soc"`
+	Load                int       `json:"load"`
+	GridPower           int       `json:"grid_power"`
+	GridVoltage         float64   `json:"grid_voltage"`
+	BatteryPower        int       `json:"battery_power"`
+	BatteryVoltage      float64   `json:"battery_voltage"`
+	BatteryTemperature  float64   `json:"battery_temperature"`
+	PV                  []MPPT    `json:"pv"`
+	InverterTemperature float64   `json:"inverter_temperature"`
+	Time                time.Time `json:"time"`
 }
 
 func (s State) String() string {
-	return fmt.Sprintf("Input power = %dW, Battery SOC = %d%%, Load = %dW.", s.Power, s.Soc, s.Load)
+	return fmt.Sprintf("Input power = %dW, Battery SOC = %d%%, Load = %dW, Grid = %dW, Battery = %dW, Data age = %s.",
+		s.Power, s.Soc, s.Load, s.GridPower, s.BatteryPower, s.Age().Round(time.Second))
+}
+
+// Age returns how long ago the inverter took the measurements.
+func (s State) Age() time.Duration {
+	return time.Since(s.Time)
+}
+
+// Stale returns true if the measurements are older than limit. A limit of
+// zero means that data is never considered stale.
+func (s State) Stale(limit time.Duration) bool {
+	return limit > 0 && s.Age() > limit
+}
+
+// plausibleAge returns false if the measurements are from the future or more than
+// an hour old, which usually means that the inverter's timezone is wrong.
+func (s State) plausibleAge() bool {
+	age := s.Age()
+	return age >= 0 && age <= time.Hour
+}
+
+// getter is implemented by the objects returned by the SunSynk API.
+type getter interface {
+	Get(key string) (any, bool)
+}
+
+// toFloat converts a value returned by the SunSynk API to a float64. The API
+// returns numbers as both JSON numbers and strings.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// floatValue returns the numeric value of key in the object; missing
+// or malformed values are reported as zero since not all inverters
+// report every value.
+func floatValue(o getter, key string) float64 {
+	v, ok := o.Get(key)
+	if !ok {
+		return 0
+	}
+	f, _ := toFloat(v)
+	return f
+}
+
+func intValue(o getter, key string) int {
+	return int(floatValue(o, key))
 }
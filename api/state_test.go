@@ -0,0 +1,112 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// object is a getter backed by a map, like the objects returned by the SunSynk API.
+type object map[string]any
+
+func (o object) Get(key string) (any, bool) {
+	v, ok := o[key]
+	return v, ok
+}
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected float64
+		ok       bool
+	}{
+		{"231.5", 231.5, true},
+		{"-40", -40, true},
+		{231.5, 231.5, true},
+		{12, 12, true},
+		{"", 0, false},
+		{"volts", 0, false},
+		{nil, 0, false},
+		{true, 0, false},
+	}
+	for _, test := range tests {
+		f, ok := toFloat(test.value)
+		if ok != test.ok {
+			t.Errorf("%#v: expected %t, got %t", test.value, test.ok, ok)
+		}
+		if f != test.expected {
+			t.Errorf("%#v: expected %f, got %f", test.value, test.expected, f)
+		}
+	}
+}
+
+func TestFloatAndIntValue(t *testing.T) {
+	o := object{"string": "48.7", "number": 48.7, "negative": "-1500", "malformed": "n/a"}
+	tests := []struct {
+		key           string
+		expectedFloat float64
+		expectedInt   int
+	}{
+		{"string", 48.7, 48},
+		{"number", 48.7, 48},
+		{"negative", -1500, -1500},
+		{"malformed", 0, 0},
+		{"missing", 0, 0},
+	}
+	for _, test := range tests {
+		if f := floatValue(o, test.key); f != test.expectedFloat {
+			t.Errorf("%s: expected %f, got %f", test.key, test.expectedFloat, f)
+		}
+		if n := intValue(o, test.key); n != test.expectedInt {
+			t.Errorf("%s: expected %d, got %d", test.key, test.expectedInt, n)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	s := State{Time: time.Now().Add(-10 * time.Minute)}
+	if age := s.Age(); age < 10*time.Minute || age > 11*time.Minute {
+		t.Errorf("expected an age of about %s, got %s", 10*time.Minute, age)
+	}
+	s = State{Time: time.Now().Add(time.Hour)}
+	if age := s.Age(); age >= 0 {
+		t.Errorf("expected a negative age, got %s", age)
+	}
+}
+
+func TestStale(t *testing.T) {
+	tests := []struct {
+		age      time.Duration
+		limit    time.Duration
+		expected bool
+	}{
+		{10 * time.Minute, 30 * time.Minute, false},
+		{40 * time.Minute, 30 * time.Minute, true},
+		{40 * time.Minute, 0, false},
+		{1000 * time.Hour, 0, false},
+		{-time.Hour, 30 * time.Minute, false},
+	}
+	for _, test := range tests {
+		s := State{Time: time.Now().Add(-test.age)}
+		if stale := s.Stale(test.limit); stale != test.expected {
+			t.Errorf("age %s, limit %s: expected %t, got %t", test.age, test.limit, test.expected, stale)
+		}
+	}
+}
+
+func TestPlausibleAge(t *testing.T) {
+	tests := []struct {
+		age      time.Duration
+		expected bool
+	}{
+		{time.Minute, true},
+		{50 * time.Minute, true},
+		{2 * time.Hour, false},
+		{-2 * time.Hour, false},
+	}
+	for _, test := range tests {
+		s := State{Time: time.Now().Add(-test.age)}
+		if ok := s.plausibleAge(); ok != test.expected {
+			t.Errorf("age %s: expected %t, got %t", test.age, test.expected, ok)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/httprecord"
+)
+
+// permissionDeniedCode is the code in the SunSynk API's response when the account
+// doesn't have permission to make the request.
+const permissionDeniedCode = 403
+
+// ErrPermissionDenied is returned if the SunSynk API rejects a request because the
+// account doesn't have permission to make it.
+var ErrPermissionDenied = errors.New("permission denied by the SunSynk API")
+
+// defaultTransport is net/http's default transport before it is replaced.
+var defaultTransport = http.DefaultTransport.(*http.Transport)
+
+// ConfigureConnection sets the base URL of the SunSynk API, the proxy and the
+// trusted certificate authorities, and the timeout for each request. synkctl's
+// REST client sends requests using net/http's default transport, so the proxy
+// and certificate authorities are applied by replacing the default transport. The
+// replacement also checks the SunSynk API's responses for ErrPermissionDenied.
+func ConfigureConnection(cfg config.API) error {
+	t := defaultTransport.Clone()
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return err
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", cfg.CABundle)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	http.DefaultTransport = &sunsynkTransport{exchanges: t, next: t}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.baseURL = strings.TrimRight(cfg.BaseURL, "/")
+	c.timeout = cfg.Timeout
+	return nil
+}
+
+// call makes a request to the SunSynk API that is bounded by the configured timeout.
+func call[T any](ctx context.Context, f func(context.Context) (T, error)) (T, error) {
+	c.mutex.Lock()
+	timeout := c.timeout
+	c.mutex.Unlock()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
+
+// sunsynkTransport sends requests to the SunSynk API using exchanges and other
+// requests, e.g. notifications posted to webhooks, using next. Only the SunSynk
+// API's exchanges are recorded or replayed since other URLs can hold secrets.
+type sunsynkTransport struct {
+	exchanges http.RoundTripper
+	next      http.RoundTripper
+}
+
+// RoundTrip sends the request using the transport for its host. A response from
+// the SunSynk API that denies permission is returned as ErrPermissionDenied. If the
+// request's context asks for it, the access token in a response is copied.
+func (t *sunsynkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mutex.Lock()
+	host := c.host
+	c.mutex.Unlock()
+	if host == "" || req.URL.Host != host {
+		return t.next.RoundTrip(req)
+	}
+	resp, err := t.exchanges.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var e envelope
+	if (json.Unmarshal(body, &e) == nil && e.Code == permissionDeniedCode) || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: %s", ErrPermissionDenied, e.Msg)
+	}
+	if token, ok := req.Context().Value(tokenKey{}).(*string); ok {
+		var data struct {
+			AccessToken string `json:"access_token"`
+		}
+		if json.Unmarshal(e.Data, &data) == nil && data.AccessToken != "" {
+			*token = data.AccessToken
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// otherTransport returns the transport used for requests other than to the SunSynk API.
+func otherTransport() http.RoundTripper {
+	if t, ok := http.DefaultTransport.(*sunsynkTransport); ok {
+		return t.next
+	}
+	return http.DefaultTransport
+}
+
+// RecordHTTP records every request to the SunSynk API, and its response, in dir
+// with credentials and tokens redacted.
+func RecordHTTP(dir string) error {
+	next := otherTransport()
+	rec, err := httprecord.NewRecorder(dir, next)
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = &sunsynkTransport{exchanges: rec, next: next}
+	return nil
+}
+
+// ReplayHTTP serves the responses recorded in dir instead of sending requests to
+// the SunSynk API.
+func ReplayHTTP(dir string) error {
+	rep, err := httprecord.NewReplayer(dir)
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = &sunsynkTransport{exchanges: rep, next: otherTransport()}
+	return nil
+}
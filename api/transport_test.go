@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/fakeserver"
+)
+
+func TestRecordOnlySunSynk(t *testing.T) {
+	serve(t, fakeserver.New("carl", "secret"))
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	if err := api.RecordHTTP(dir); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := api.NewInverter("").Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Webhook URLs can hold secrets so notifications aren't recorded.
+	resp, err := http.Post(webhook.URL+"/hooks/secret", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Errorf("expected %d exchanges, got %d", 1, len(files))
+	}
+
+	// Notifications are still sent while the SunSynk API's exchanges are replayed.
+	if err = api.ReplayHTTP(dir); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(webhook.URL+"/hooks/secret", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestPermissionDenied(t *testing.T) {
+	s := fakeserver.New("carl", "secret")
+	serve(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	inv := api.NewInverter("")
+	if err := inv.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fakeserver.ParseFault("permission-denied:update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Inject(f)
+	if err = inv.UpdateBatteryCapacity(35); !errors.Is(err, api.ErrPermissionDenied) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+	s.ClearFaults()
+	if err = inv.UpdateBatteryCapacity(35); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records every change to the inverter's settings that gnomon
+// attempts in an append-only file with one JSON object per line.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry records an attempt to change one of the inverter's settings.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Inverter string    `json:"inverter,omitempty"`
+	Setting  string    `json:"setting"`
+	OldValue any       `json:"old_value"`
+	NewValue any       `json:"new_value"`
+	// Reason explains which handler made the change and why.
+	Reason   string `json:"reason"`
+	Attempts int    `json:"attempts"`
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+type auditLog struct {
+	mutex sync.Mutex
+	path  string
+}
+
+var a auditLog
+
+// SetFile sets the path of the audit file. Nothing is recorded if the path is empty.
+func SetFile(path string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.path = path
+}
+
+// Record appends an entry to the audit file.
+func Record(e Entry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Read returns all entries in the audit file at path. An empty slice is
+// returned if the file doesn't exist.
+func Read(path string) ([]Entry, error) {
+	entries := []Entry{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
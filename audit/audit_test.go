@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := Record(Entry{Setting: "battery_capacity"}); err != nil {
+		t.Fatal(err)
+	}
+
+	SetFile(path)
+	defer SetFile("")
+	now := time.Now().Truncate(time.Second)
+	if err := Record(Entry{Time: now, Setting: "battery_capacity", OldValue: 40, NewValue: 35, Reason: "soc: peak SOC was 100%", Attempts: 1, Verified: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(Entry{Time: now, Setting: "essential_only", OldValue: true, NewValue: false, Reason: "ctcoil", Attempts: 10, Error: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected %d entries, got %d", 2, len(entries))
+	}
+	if !entries[0].Time.Equal(now) || entries[0].NewValue != 35.0 || !entries[0].Verified {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+	if entries[1].Verified || entries[1].Error != "timeout" || entries[1].OldValue != true {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+}
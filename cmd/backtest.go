@@ -0,0 +1,104 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/handlers"
+	"github.com/hammingweight/gnomon/recorder"
+	"github.com/spf13/cobra"
+)
+
+var backtestThreshold = SoC(40)
+var backtestLowBattery = SoC(20)
+var backtestMinSoc = SoC(-1)
+var backtestMaxSoc = SoC(-1)
+var backtestDeltaSoc = SoC(5)
+var backtestCtSoc = SoC(0)
+
+var backtestCmd = &cobra.Command{
+	Use:   "backtest",
+	Short: "Replays recorded inverter states through gnomon's logic",
+	Long: `backtest replays recorded inverter states (CSV or JSON lines files, such as
+those written when gnomon is run with the --record flag) through the handlers
+that gnomon uses to manage the battery's depth of discharge, the CT coil and
+grid outages. The inverter is simulated and every change that gnomon would make
+to its settings is printed.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputs, err := cmd.Flags().GetStringSlice("input")
+		if err != nil {
+			return err
+		}
+		ratedPower, err := cmd.Flags().GetInt("rated-power")
+		if err != nil {
+			return err
+		}
+
+		cfg, err := readConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		states := []api.State{}
+		for _, input := range inputs {
+			s, err := recorder.ReadStates(input)
+			if err != nil {
+				return err
+			}
+			states = append(states, s...)
+		}
+
+		opts := handlers.BacktestOptions{
+			Threshold:          backtestThreshold.Int(),
+			LowBatteryCapacity: backtestLowBattery.Int(),
+			RatedPower:         ratedPower,
+			MinSoc:             backtestMinSoc.Int(),
+			MaxSoc:             backtestMaxSoc.Int(),
+			DeltaSoc:           backtestDeltaSoc.Int(),
+			Ct:                 backtestCtSoc.Int(),
+			Schedule:           cfg.SocSchedule,
+			CtWindows:          cfg.CtWindows,
+		}
+		if err = checkSocFlags(backtestMinSoc, backtestMaxSoc); err != nil {
+			return err
+		}
+		decisions, err := handlers.Backtest(states, opts)
+		if err != nil {
+			return err
+		}
+		for _, d := range decisions {
+			fmt.Println(d)
+		}
+		return nil
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(backtestCmd)
+	backtestCmd.Flags().StringSliceP("input", "i", []string{}, "recordings of inverter states (CSV or .jsonl)")
+	backtestCmd.MarkFlagRequired("input")
+	backtestCmd.Flags().IntP("rated-power", "p", 5000, "rated power of the inverter in watts")
+	backtestCmd.Flags().VarP(&backtestThreshold, "threshold", "t", "battery discharge threshold at the start of the backtest")
+	backtestCmd.Flags().Var(&backtestLowBattery, "low-battery", "battery SoC that generates a low battery alarm")
+	backtestCmd.Flags().VarP(&backtestCtSoc, "ct-coil", "C", "manage power to the non-essential load")
+	backtestCmd.Flags().VarP(&backtestMinSoc, "min-soc", "m", "minimum battery state of charge")
+	backtestCmd.Flags().VarP(&backtestMaxSoc, "max-soc", "M", "maximum battery state of charge")
+	backtestCmd.Flags().VarP(&backtestDeltaSoc, "delta-soc", "d", "maximum change to the battery state of charge")
+}
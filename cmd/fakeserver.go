@@ -0,0 +1,122 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hammingweight/gnomon/fakeserver"
+	"github.com/hammingweight/gnomon/recorder"
+	"github.com/spf13/cobra"
+)
+
+var fakeServerCmd = &cobra.Command{
+	Use:   "fake-server",
+	Short: "Runs a local stand-in for the SunSynk API",
+	Long: `fake-server runs a local HTTP server that mimics the SunSynk API endpoints used
+by gnomon, so that gnomon can be run against a simulated inverter. Point the
+endpoint in a synkctl config file at the server's address to use it. The
+inverter's readings can be played back from a recording and faults can be
+injected in the form kind[:endpoint[:count]], where kind is unauthorized,
+timeout, permission-denied or server-error and endpoint is auth, inverters,
+input, battery, load, grid, settings, update or details, e.g.
+
+  gnomon fake-server --fault unauthorized:input:3 --fault permission-denied:update`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+		user, err := cmd.Flags().GetString("user")
+		if err != nil {
+			return err
+		}
+		password, err := cmd.Flags().GetString("password")
+		if err != nil {
+			return err
+		}
+		sns, err := cmd.Flags().GetStringSlice("sn")
+		if err != nil {
+			return err
+		}
+		faults, err := cmd.Flags().GetStringSlice("fault")
+		if err != nil {
+			return err
+		}
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+
+		s := fakeserver.New(user, password, sns...)
+		for _, f := range faults {
+			fault, err := fakeserver.ParseFault(f)
+			if err != nil {
+				return err
+			}
+			s.Inject(fault)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if input != "" {
+			states, err := recorder.ReadStates(input)
+			if err != nil {
+				return err
+			}
+			for _, sn := range sns {
+				go func() {
+					if err := s.Play(ctx, sn, states, interval); err != nil && ctx.Err() == nil {
+						log.Println("Failed to play states: ", err)
+					}
+				}()
+			}
+		}
+
+		srv := &http.Server{Addr: addr, Handler: s}
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		log.Printf("Fake SunSynk API listening on %s\n", addr)
+		if err = srv.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(fakeServerCmd)
+	fakeServerCmd.Flags().String("listen", "localhost:8080", "address to listen on")
+	fakeServerCmd.Flags().String("user", "", "user that may authenticate (any user if empty)")
+	fakeServerCmd.Flags().String("password", "", "password of the user")
+	fakeServerCmd.Flags().StringSlice("sn", []string{fakeserver.DefaultSN}, "serial numbers of the simulated inverters")
+	fakeServerCmd.Flags().StringSlice("fault", []string{}, "fault to inject, kind[:endpoint[:count]]")
+	fakeServerCmd.Flags().StringP("input", "i", "", "recording of inverter states to play back (CSV or .jsonl)")
+	fakeServerCmd.Flags().Duration("interval", time.Minute, "time between the states that are played back")
+}
@@ -17,11 +17,17 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/credentials"
 	"github.com/hammingweight/gnomon/handlers"
+	"github.com/hammingweight/gnomon/recorder"
 	"github.com/hammingweight/synkctl/configuration"
 	"github.com/spf13/cobra"
 )
@@ -50,13 +56,111 @@ func getDelayAndRunningTime() (time.Duration, time.Duration, error) {
 	return delay, runTime, nil
 }
 
+// readConfig reads gnomon's configuration file.
+func readConfig(cmd *cobra.Command) (*config.Config, error) {
+	path, err := cmd.Flags().GetString("gnomon-config")
+	if err != nil {
+		return nil, err
+	}
+	return config.Read(path)
+}
+
+// configureAPI configures how gnomon connects to the SunSynk API and where the
+// credentials are read from. The --api-url flag overrides the configured base URL
+// and the --record-http and --replay-http flags record or replay the API's responses.
+// The --modbus flag overrides the configured Modbus URL of the default inverter.
+func configureAPI(cmd *cobra.Command, cfg *config.Config) error {
+	apiURL, err := cmd.Flags().GetString("api-url")
+	if err != nil {
+		return err
+	}
+	if apiURL != "" {
+		cfg.API.BaseURL = apiURL
+		if err = cfg.API.Validate(); err != nil {
+			return err
+		}
+	}
+	if err = api.ConfigureConnection(cfg.API); err != nil {
+		return err
+	}
+	recordDir, err := cmd.Flags().GetString("record-http")
+	if err != nil {
+		return err
+	}
+	replayDir, err := cmd.Flags().GetString("replay-http")
+	if err != nil {
+		return err
+	}
+	if recordDir != "" && replayDir != "" {
+		return errors.New("--record-http and --replay-http can't be used together")
+	}
+	if recordDir != "" {
+		if err = api.RecordHTTP(recordDir); err != nil {
+			return err
+		}
+	}
+	if replayDir != "" {
+		if err = api.ReplayHTTP(replayDir); err != nil {
+			return err
+		}
+	}
+	modbusURL, err := cmd.Flags().GetString("modbus")
+	if err != nil {
+		return err
+	}
+	if modbusURL != "" {
+		cfg.Modbus.URL = modbusURL
+		if err = cfg.Modbus.Validate(); err != nil {
+			return err
+		}
+	}
+	p, err := credentials.New(cfg.Credentials)
+	if err != nil {
+		return err
+	}
+	api.SetCredentialsProvider(p)
+	return nil
+}
+
+// selectInverter returns the serial number passed with --inverter. If several
+// inverters are configured, the selected inverter must be one of them.
+func selectInverter(cmd *cobra.Command, cfg *config.Config) (string, error) {
+	sn, err := cmd.Flags().GetString("inverter")
+	if err != nil {
+		return "", err
+	}
+	if sn == "" || len(cfg.Inverters) == 0 {
+		return sn, nil
+	}
+	for _, inv := range cfg.Inverters {
+		if inv.SN == sn {
+			return sn, nil
+		}
+	}
+	return "", fmt.Errorf("inverter %s is not listed in gnomon's configuration", sn)
+}
+
 var startTime HhMm
 var endTime HhMm
 var minSoc SoC = SoC(-1)
+var maxSoc SoC = SoC(-1)
 var deltaSoc = SoC(5)
 var ctSoc = SoC(0)
 
+// checkSocFlags checks that the minimum and maximum battery SoC flags are consistent.
+func checkSocFlags(minSoc SoC, maxSoc SoC) error {
+	if minSoc >= 0 && maxSoc >= 0 && minSoc > maxSoc {
+		return fmt.Errorf("minimum battery SoC (%d%%) is greater than the maximum battery SoC (%d%%)", minSoc, maxSoc)
+	}
+	return nil
+}
+
 func run(cmd *cobra.Command) error {
+	// Check the flags before waiting to start.
+	if err := checkSocFlags(minSoc, maxSoc); err != nil {
+		return err
+	}
+
 	// Set up logging
 	logfile, err := cmd.Flags().GetString("logfile")
 	if err != nil {
@@ -75,8 +179,95 @@ func run(cmd *cobra.Command) error {
 		return err
 	}
 
+	// Read gnomon's configuration.
+	cfg, err := readConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err = configureAPI(cmd, cfg); err != nil {
+		return err
+	}
+	sn, err := selectInverter(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Find the journal file.
+	journalFile, err := cmd.Flags().GetString("journal")
+	if err != nil {
+		return err
+	}
+
+	// Find the history file.
+	historyFile, err := cmd.Flags().GetString("history")
+	if err != nil {
+		return err
+	}
+
+	// Find the audit file.
+	auditFile, err := cmd.Flags().GetString("audit")
+	if err != nil {
+		return err
+	}
+
+	// Find where to record the inverter's states.
+	recordDir, err := cmd.Flags().GetString("record")
+	if err != nil {
+		return err
+	}
+	recordFormat, err := cmd.Flags().GetString("record-format")
+	if err != nil {
+		return err
+	}
+
+	// Find the timezone of the inverter's timestamps.
+	timezone, err := cmd.Flags().GetString("timezone")
+	if err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+
+	// Find the age at which the inverter's data is stale.
+	staleLimit, err := cmd.Flags().GetDuration("stale-limit")
+	if err != nil {
+		return err
+	}
+
+	// Find how long to back off after a manual change to the inverter's settings.
+	overrideBackoff, err := cmd.Flags().GetDuration("override-backoff")
+	if err != nil {
+		return err
+	}
+
 	// Start managing.
-	return handlers.ManageInverter(logfile, delay, runTime, configFile, minSoc.Int(), deltaSoc.Int(), ctSoc.Int())
+	opts := handlers.Options{
+		Logfile:         logfile,
+		Delay:           delay,
+		RunTime:         runTime,
+		ConfigFile:      configFile,
+		JournalFile:     journalFile,
+		HistoryFile:     historyFile,
+		AuditFile:       auditFile,
+		RecordDir:       recordDir,
+		RecordFormat:    recordFormat,
+		Location:        location,
+		StaleLimit:      staleLimit,
+		MinSoc:          minSoc.Int(),
+		MaxSoc:          maxSoc.Int(),
+		DeltaSoc:        deltaSoc.Int(),
+		Schedule:        cfg.SocSchedule,
+		Notifications:   cfg.Notifications,
+		CtWindows:       cfg.CtWindows,
+		OverrideBackoff: overrideBackoff,
+		Ct:              ctSoc.Int(),
+		Inverter:        sn,
+		Modbus:          cfg.Modbus,
+		Inverters:       cfg.Inverters,
+	}
+	return handlers.ManageInverter(opts)
 }
 
 var gnomonCmd = &cobra.Command{
@@ -105,11 +296,26 @@ func init() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	gnomonCmd.Flags().StringP("config", "c", configFile, "synkctl config file path")
+	gnomonCmd.PersistentFlags().StringP("config", "c", configFile, "synkctl config file path")
+	gnomonCmd.PersistentFlags().StringP("gnomon-config", "g", filepath.Join(filepath.Dir(configFile), "gnomon.yaml"), "gnomon config file path")
 	gnomonCmd.Flags().VarP(&startTime, "start", "s", "start time in 24 hour HH:MM format, e.g. 06:00")
 	gnomonCmd.Flags().VarP(&endTime, "end", "e", "end time in 24 hour HH:MM format, e.g. 19:30")
-	gnomonCmd.Flags().StringP("logfile", "l", "", "log file path")
+	gnomonCmd.PersistentFlags().StringP("logfile", "l", "", "log file path")
+	gnomonCmd.PersistentFlags().StringP("journal", "j", filepath.Join(filepath.Dir(configFile), "gnomon.journal"), "journal file path for crash recovery")
+	gnomonCmd.PersistentFlags().String("history", filepath.Join(filepath.Dir(configFile), "gnomon-history.jsonl"), "history file path")
+	gnomonCmd.PersistentFlags().String("api-url", "", "base URL of the SunSynk API (overrides the synkctl config's endpoint)")
+	gnomonCmd.PersistentFlags().String("inverter", "", "serial number of the inverter to manage (overrides the synkctl config's default inverter)")
+	gnomonCmd.PersistentFlags().String("modbus", "", "Modbus URL of the inverter, e.g. tcp://192.168.1.50:502 or rtu:///dev/ttyUSB0")
+	gnomonCmd.PersistentFlags().String("record-http", "", "directory to record requests to the SunSynk API in (credentials are redacted)")
+	gnomonCmd.PersistentFlags().String("replay-http", "", "directory of recorded requests to serve instead of using the SunSynk API")
+	gnomonCmd.PersistentFlags().String("audit", filepath.Join(filepath.Dir(configFile), "gnomon-audit.jsonl"), "audit file path for changes to the inverter's settings")
 	gnomonCmd.Flags().VarP(&ctSoc, "ct-coil", "C", "manage power to the non-essential load")
 	gnomonCmd.Flags().VarP(&minSoc, "min-soc", "m", "minimum battery state of charge")
+	gnomonCmd.Flags().VarP(&maxSoc, "max-soc", "M", "maximum battery state of charge")
 	gnomonCmd.Flags().VarP(&deltaSoc, "delta-soc", "d", "maximum change to the battery state of charge")
+	gnomonCmd.Flags().StringP("record", "r", "", "directory for daily recordings of the inverter's states")
+	gnomonCmd.Flags().String("record-format", recorder.CSV, "format of the recordings: csv or jsonl")
+	gnomonCmd.Flags().StringP("timezone", "z", "Local", "timezone of the inverter's timestamps, e.g. Africa/Johannesburg")
+	gnomonCmd.Flags().Duration("override-backoff", 0, "how long to stop managing a manually changed setting (0 for the rest of the run)")
+	gnomonCmd.Flags().Duration("stale-limit", 30*time.Minute, "age after which the inverter's data is stale (0 to disable)")
 }
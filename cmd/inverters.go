@@ -0,0 +1,113 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the inverters and status commands.
+const (
+	tableFormat = "table"
+	jsonFormat  = "json"
+)
+
+// checkFormat checks that the output format is known.
+func checkFormat(format string) error {
+	if format != tableFormat && format != jsonFormat {
+		return fmt.Errorf("unknown format %s; must be %s or %s", format, tableFormat, jsonFormat)
+	}
+	return nil
+}
+
+// writeInverters writes the inverters as JSON or, otherwise, as a table.
+func writeInverters(w io.Writer, format string, infos []api.InverterInfo) error {
+	switch format {
+	case jsonFormat:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERIAL\tMODEL\tRATED POWER\tFIRMWARE\tPLANT\tSTATUS")
+		for _, i := range infos {
+			status := "offline"
+			if i.Online {
+				status = "online"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%dW\t%s\t%s\t%s\n", i.SN, i.Model, i.RatedPower, i.Firmware, i.Plant, status)
+		}
+		return tw.Flush()
+	}
+}
+
+var invertersCmd = &cobra.Command{
+	Use:   "inverters",
+	Short: "Lists the inverters on the SunSynk account",
+	Long: `inverters lists all the inverters on the authenticated SunSynk account with their
+serial number, model, rated power, firmware version, plant and whether they are online.
+Use the serial number as the default_inverter_sn in the synkctl config file or pass it
+to gnomon with --inverter.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		if err = checkFormat(format); err != nil {
+			return err
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		cfg, err := readConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if err = configureAPI(cmd, cfg); err != nil {
+			return err
+		}
+		api.SetConfigFile(configFile)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		infos, err := api.ListInverters(ctx)
+		if err != nil {
+			return err
+		}
+		return writeInverters(os.Stdout, format, infos)
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(invertersCmd)
+	invertersCmd.Flags().StringP("format", "f", tableFormat, "output format: table or json")
+	invertersCmd.Flags().Duration("timeout", time.Minute, "how long to wait for the list of inverters")
+}
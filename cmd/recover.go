@@ -0,0 +1,74 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/hammingweight/gnomon/handlers"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Restores the inverter's settings after gnomon exited uncleanly",
+	Long: `recover checks gnomon's journal for a run that did not exit cleanly and, if one
+is found, configures the inverter to power only the essential loads and restores
+the battery's minimum SoC to the last value that gnomon set.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logfile, err := cmd.Flags().GetString("logfile")
+		if err != nil {
+			return err
+		}
+		configFile, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		cfg, err := readConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if err = configureAPI(cmd, cfg); err != nil {
+			return err
+		}
+		sn, err := selectInverter(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		journalFile, err := cmd.Flags().GetString("journal")
+		if err != nil {
+			return err
+		}
+		auditFile, err := cmd.Flags().GetString("audit")
+		if err != nil {
+			return err
+		}
+		opts := handlers.Options{
+			Logfile:     logfile,
+			ConfigFile:  configFile,
+			JournalFile: journalFile,
+			AuditFile:   auditFile,
+			Inverter:    sn,
+			Modbus:      cfg.Modbus,
+			Inverters:   cfg.Inverters,
+		}
+		return handlers.RecoverInverter(opts)
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(recoverCmd)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/hammingweight/gnomon/history"
+	"github.com/hammingweight/gnomon/report"
+	"github.com/spf13/cobra"
+)
+
+var reportFrom Date
+var reportTo Date
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarizes gnomon's history",
+	Long: `report summarizes gnomon's history by day or by week. The summary includes the
+battery discharge thresholds, the battery's minimum and maximum SoC, how long the
+inverter powered all loads, how often the CT coil was switched, energy totals and
+the load that was not drawn from the grid while the inverter powered all loads.
+If the history has runs for several inverters, select one with --inverter.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		historyFile, err := cmd.Flags().GetString("history")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		weekly, err := cmd.Flags().GetBool("weekly")
+		if err != nil {
+			return err
+		}
+		tariff, err := cmd.Flags().GetFloat64("tariff")
+		if err != nil {
+			return err
+		}
+		sn, err := cmd.Flags().GetString("inverter")
+		if err != nil {
+			return err
+		}
+
+		runs, err := history.Read(historyFile)
+		if err != nil {
+			return err
+		}
+		rows, err := report.Summarize(runs, sn, reportFrom.String(), reportTo.String(), weekly, tariff)
+		if err != nil {
+			return err
+		}
+		return report.Write(os.Stdout, format, rows)
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(reportCmd)
+	reportCmd.Flags().Var(&reportFrom, "from", "first date to report on in YYYY-MM-DD format")
+	reportCmd.Flags().Var(&reportTo, "to", "last date to report on in YYYY-MM-DD format")
+	reportCmd.Flags().StringP("format", "f", report.Markdown, "report format: markdown, html or json")
+	reportCmd.Flags().BoolP("weekly", "w", false, "summarize by week rather than by day")
+	reportCmd.Flags().Float64P("tariff", "t", 0, "cost of a kWh of grid energy, used to cost the load not drawn from the grid")
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hammingweight/gnomon/handlers"
+	"github.com/spf13/cobra"
+)
+
+// writeStatus writes the statuses as JSON or, otherwise, as a table with a column
+// for each inverter.
+func writeStatus(w io.Writer, format string, statuses []handlers.Status) error {
+	if format == jsonFormat {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	rows := []struct {
+		name  string
+		value func(s handlers.Status) string
+	}{
+		{"INVERTER", func(s handlers.Status) string {
+			if s.Inverter == "" {
+				return "-"
+			}
+			return s.Inverter
+		}},
+		{"UPDATED", func(s handlers.Status) string {
+			return fmt.Sprintf("%s (%s ago)", s.State.Time.Format(time.DateTime), s.State.Age().Round(time.Second))
+		}},
+		{"INPUT POWER", func(s handlers.Status) string { return fmt.Sprintf("%dW", s.State.Power) }},
+		{"BATTERY SOC", func(s handlers.Status) string { return fmt.Sprintf("%d%%", s.State.Soc) }},
+		{"BATTERY POWER", func(s handlers.Status) string { return fmt.Sprintf("%dW", s.State.BatteryPower) }},
+		{"LOAD", func(s handlers.Status) string { return fmt.Sprintf("%dW", s.State.Load) }},
+		{"GRID POWER", func(s handlers.Status) string { return fmt.Sprintf("%dW", s.State.GridPower) }},
+		{"GRID VOLTAGE", func(s handlers.Status) string { return fmt.Sprintf("%.0fV", s.State.GridVoltage) }},
+		{"DISCHARGE THRESHOLD", func(s handlers.Status) string { return fmt.Sprintf("%d%%", s.BatteryDischargeThreshold) }},
+		{"LOW BATTERY CAPACITY", func(s handlers.Status) string { return fmt.Sprintf("%d%%", s.LowBatteryCapacity) }},
+		{"ESSENTIAL ONLY", func(s handlers.Status) string { return fmt.Sprint(s.EssentialOnly) }},
+		{"RATED POWER", func(s handlers.Status) string { return fmt.Sprintf("%dW", s.RatedPower) }},
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range rows {
+		values := []string{r.name}
+		for _, s := range statuses {
+			values = append(values, r.value(s))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Prints the inverter's current state and settings",
+	Long: `status authenticates, reads the inverter's current state, battery discharge threshold,
+low battery capacity, essential-only setting and rated power, prints them and exits.
+No settings are changed. If several inverters are configured, the status of each is
+printed. status exits with a non-zero code if it can't read an inverter's status
+within the timeout or if an inverter's data is stale, so it can be used as a probe.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		if err = checkFormat(format); err != nil {
+			return err
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		staleLimit, err := cmd.Flags().GetDuration("stale-limit")
+		if err != nil {
+			return err
+		}
+		timezone, err := cmd.Flags().GetString("timezone")
+		if err != nil {
+			return err
+		}
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return err
+		}
+		cfg, err := readConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if err = configureAPI(cmd, cfg); err != nil {
+			return err
+		}
+		sn, err := selectInverter(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		opts := handlers.Options{
+			ConfigFile: configFile,
+			Location:   location,
+			Inverter:   sn,
+			Modbus:     cfg.Modbus,
+			Inverters:  cfg.Inverters,
+		}
+		statuses, err := handlers.ReadStatus(ctx, opts)
+		if len(statuses) > 0 {
+			if err := writeStatus(os.Stdout, format, statuses); err != nil {
+				return err
+			}
+		}
+		errs := []error{err}
+		for _, s := range statuses {
+			if s.State.Stale(staleLimit) {
+				errs = append(errs, fmt.Errorf("inverter %s: data is %s old", s.Inverter, s.State.Age().Round(time.Second)))
+			}
+		}
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	gnomonCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringP("format", "f", tableFormat, "output format: table or json")
+	statusCmd.Flags().Duration("timeout", time.Minute, "how long to wait for the inverter's status")
+	statusCmd.Flags().Duration("stale-limit", 30*time.Minute, "age after which the inverter's data is stale (0 to disable)")
+	statusCmd.Flags().StringP("timezone", "z", "Local", "timezone of the inverter's timestamps, e.g. Africa/Johannesburg")
+}
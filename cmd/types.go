@@ -118,3 +118,25 @@ func (soc *SoC) String() string {
 func (soc *SoC) Int() int {
 	return int(*soc)
 }
+
+// Date is a string that represents a date in YYYY-MM-DD format.
+type Date string
+
+// Set sets a date and validates that the string argument is in
+// YYYY-MM-DD format.
+func (d *Date) Set(s string) error {
+	if _, err := time.Parse(time.DateOnly, s); err != nil {
+		return fmt.Errorf("%s is not in the form YYYY-MM-DD", s)
+	}
+	*d = Date(s)
+	return nil
+}
+
+// Type returns a string showing how a CLI should display the type.
+func (d *Date) Type() string {
+	return "YYYY-MM-DD"
+}
+
+func (d *Date) String() string {
+	return string(*d)
+}
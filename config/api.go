@@ -0,0 +1,58 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// API configures how gnomon connects to the SunSynk API.
+type API struct {
+	// BaseURL replaces the endpoint in the synkctl config file, e.g. to use a
+	// local stand-in for the API.
+	BaseURL string `yaml:"base_url"`
+	// Proxy is the URL of an HTTP(S) proxy; the HTTPS_PROXY and HTTP_PROXY
+	// environment variables are used if it is empty.
+	Proxy string `yaml:"proxy"`
+	// CABundle is a PEM file of certificate authorities that are trusted in
+	// addition to the system's authorities.
+	CABundle string `yaml:"ca_bundle"`
+	// Timeout bounds each request to the API; zero means no timeout.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks that the URLs are well-formed.
+func (a API) Validate() error {
+	for _, u := range []string{a.BaseURL, a.Proxy} {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return err
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return errors.New("an api url must have a scheme and a host, e.g. https://api.sunsynk.net")
+		}
+	}
+	if a.Timeout < 0 {
+		return errors.New("the api timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config reads gnomon's YAML configuration file. The configuration holds
+// settings that are too detailed to pass as command line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is gnomon's configuration.
+type Config struct {
+	// SocSchedule bounds the battery discharge threshold by time of year.
+	SocSchedule Schedule `yaml:"soc_schedule"`
+	// Notifications configures where gnomon sends notifications of events.
+	Notifications Notifications `yaml:"notifications"`
+	// CtWindows restricts when the CT coil may be switched on.
+	CtWindows Windows `yaml:"ct_windows"`
+	// Credentials specifies where the credentials for the SunSynk API are found.
+	Credentials Credentials `yaml:"credentials"`
+	// API configures how gnomon connects to the SunSynk API.
+	API API `yaml:"api"`
+	// Modbus configures communication with the inverter over Modbus.
+	Modbus Modbus `yaml:"modbus"`
+	// Inverters lists the inverters to manage when there is more than one.
+	Inverters Inverters `yaml:"inverters"`
+}
+
+// Webhook is a URL that events are posted to as JSON.
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Email configures an SMTP server and the addresses that events are emailed to.
+type Email struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Command is a local command that is run with an event as JSON on its stdin.
+type Command struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+}
+
+// EventTypes are the types of event that notifications can be sent for. They are
+// the notify package's types of event.
+var EventTypes = []string{
+	"threshold_changed",
+	"ct_switched",
+	"api_failures",
+	"authentication_failed",
+	"permission_denied",
+	"gave_up",
+	"grid_outage",
+	"grid_restored",
+	"manual_override",
+}
+
+// Notifications lists the sinks that events are sent to. If Events is not empty,
+// only the listed types of event are sent.
+type Notifications struct {
+	Events   []string  `yaml:"events"`
+	Webhooks []Webhook `yaml:"webhooks"`
+	Email    []Email   `yaml:"email"`
+	Commands []Command `yaml:"commands"`
+}
+
+// Validate checks that the events are known types of event and that the sinks are
+// fully specified.
+func (n Notifications) Validate() error {
+	for _, e := range n.Events {
+		if !slices.Contains(EventTypes, e) {
+			return fmt.Errorf("unknown notification event %q, must be one of %s", e, strings.Join(EventTypes, ", "))
+		}
+	}
+	for _, w := range n.Webhooks {
+		if w.URL == "" {
+			return errors.New("a webhook must have a url")
+		}
+	}
+	for _, e := range n.Email {
+		if e.Host == "" || e.From == "" || len(e.To) == 0 {
+			return errors.New("an email notification must have a host, a from address and at least one to address")
+		}
+	}
+	for _, c := range n.Commands {
+		if c.Command == "" {
+			return errors.New("a command notification must have a command")
+		}
+	}
+	return nil
+}
+
+// Read reads the configuration file at path. An empty configuration is returned
+// if the file doesn't exist.
+func Read(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that the configuration is consistent.
+func (cfg *Config) Validate() error {
+	if err := cfg.SocSchedule.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.CtWindows.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Credentials.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.API.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Modbus.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Inverters.Validate(); err != nil {
+		return err
+	}
+	return cfg.Notifications.Validate()
+}
+
+// Period bounds the battery discharge threshold for part of the year. A period
+// is either a list of months or a range of dates in MM-DD format; a date range
+// can wrap around the end of the year.
+type Period struct {
+	Months []int  `yaml:"months"`
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	// MinSoc is the lowest allowed threshold; zero means gnomon's default.
+	MinSoc int `yaml:"min_soc"`
+	// MaxSoc is the highest allowed threshold; zero means 100%.
+	MaxSoc int `yaml:"max_soc"`
+}
+
+// Max returns the highest allowed battery discharge threshold for the period.
+func (p Period) Max() int {
+	if p.MaxSoc == 0 {
+		return 100
+	}
+	return p.MaxSoc
+}
+
+func parseMonthDay(s string) (time.Time, error) {
+	t, err := time.Parse("01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("%s is not in the form MM-DD", s)
+	}
+	return t, nil
+}
+
+// Validate checks that the period is well-formed.
+func (p Period) Validate() error {
+	if len(p.Months) > 0 && (p.From != "" || p.To != "") {
+		return errors.New("a schedule period must have either months or a date range, not both")
+	}
+	if len(p.Months) == 0 && (p.From == "" || p.To == "") {
+		return errors.New("a schedule period must have months or both from and to dates")
+	}
+	for _, m := range p.Months {
+		if m < 1 || m > 12 {
+			return fmt.Errorf("month must be in the range 1-12, not %d", m)
+		}
+	}
+	if p.From != "" {
+		if _, err := parseMonthDay(p.From); err != nil {
+			return err
+		}
+		if _, err := parseMonthDay(p.To); err != nil {
+			return err
+		}
+	}
+	if p.MinSoc < 0 || p.MinSoc > 100 {
+		return fmt.Errorf("battery SoC must be in the range 0-100, not %d", p.MinSoc)
+	}
+	if p.MaxSoc < 0 || p.MaxSoc > 100 {
+		return fmt.Errorf("battery SoC must be in the range 0-100, not %d", p.MaxSoc)
+	}
+	if p.MinSoc > p.Max() {
+		return fmt.Errorf("minimum SoC (%d%%) is greater than the maximum SoC (%d%%)", p.MinSoc, p.Max())
+	}
+	return nil
+}
+
+// Contains returns true if the date t falls within the period.
+func (p Period) Contains(t time.Time) bool {
+	if len(p.Months) > 0 {
+		for _, m := range p.Months {
+			if time.Month(m) == t.Month() {
+				return true
+			}
+		}
+		return false
+	}
+	date := t.Format("01-02")
+	if p.From <= p.To {
+		return date >= p.From && date <= p.To
+	}
+	return date >= p.From || date <= p.To
+}
+
+// Schedule is a list of periods. The first period that contains a date applies
+// to that date.
+type Schedule []Period
+
+// Validate checks that all the periods in the schedule are well-formed.
+func (s Schedule) Validate() error {
+	for i, p := range s {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("soc_schedule entry %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Find returns the period that applies to the date t. It returns false if no
+// period applies.
+func (s Schedule) Find(t time.Time) (Period, bool) {
+	for _, p := range s {
+		if p.Contains(t) {
+			return p, true
+		}
+	}
+	return Period{}, false
+}
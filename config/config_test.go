@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduleFind(t *testing.T) {
+	s := Schedule{
+		{Months: []int{6, 7}, MinSoc: 50},
+		{From: "11-15", To: "02-15", MinSoc: 30, MaxSoc: 60},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := s.Find(time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC))
+	if !ok || p.MinSoc != 50 || p.Max() != 100 {
+		t.Errorf("expected the winter period, got %v", p)
+	}
+
+	p, ok = s.Find(time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC))
+	if !ok || p.MinSoc != 30 || p.Max() != 60 {
+		t.Errorf("expected the summer period, got %v", p)
+	}
+
+	p, ok = s.Find(time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC))
+	if !ok || p.MinSoc != 30 {
+		t.Errorf("expected the summer period, got %v", p)
+	}
+
+	_, ok = s.Find(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if ok {
+		t.Error("expected no period in April")
+	}
+}
+
+func TestPeriodValidate(t *testing.T) {
+	invalid := []Period{
+		{},
+		{Months: []int{13}},
+		{Months: []int{1}, From: "01-01", To: "01-31"},
+		{From: "01-32", To: "02-01"},
+		{Months: []int{1}, MinSoc: 70, MaxSoc: 60},
+	}
+	for _, p := range invalid {
+		if p.Validate() == nil {
+			t.Errorf("expected %v to be invalid", p)
+		}
+	}
+}
+
+func TestWindowsBlocking(t *testing.T) {
+	ws := Windows{
+		{Action: Off, Start: "17:00", End: "21:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}},
+		{Action: Allow, Start: "10:00", End: "19:00"},
+	}
+	if err := ws.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2025-05-23 is a Friday.
+	friday := func(h int, m int) time.Time {
+		return time.Date(2025, 5, 23, h, m, 0, 0, time.UTC)
+	}
+	if _, blocked := ws.Blocking(friday(12, 0)); blocked {
+		t.Error("expected 12:00 to be allowed")
+	}
+	if _, blocked := ws.Blocking(friday(17, 30)); !blocked {
+		t.Error("expected 17:30 on a Friday to be blocked")
+	}
+	if _, blocked := ws.Blocking(friday(9, 59)); !blocked {
+		t.Error("expected 09:59 to be blocked")
+	}
+	if _, blocked := ws.Blocking(friday(17, 30).AddDate(0, 0, 1)); blocked {
+		t.Error("expected 17:30 on a Saturday to be allowed")
+	}
+
+	// An off window blocks even if an allow window that contains the time is listed first.
+	ws[0], ws[1] = ws[1], ws[0]
+	if _, blocked := ws.Blocking(friday(17, 30)); !blocked {
+		t.Error("expected 17:30 on a Friday to be blocked when the allow window is listed first")
+	}
+	if _, blocked := ws.Blocking(friday(12, 0)); blocked {
+		t.Error("expected 12:00 to be allowed when the allow window is listed first")
+	}
+
+	overnight := Window{Action: Off, Start: "22:00", End: "06:00", Days: []string{"fri"}}
+	if !overnight.Contains(time.Date(2025, 5, 24, 5, 0, 0, 0, time.UTC)) {
+		t.Error("expected 05:00 on Saturday to be in Friday's overnight window")
+	}
+	if overnight.Contains(time.Date(2025, 5, 23, 5, 0, 0, 0, time.UTC)) {
+		t.Error("expected 05:00 on Friday not to be in Friday's overnight window")
+	}
+}
+
+func TestReadAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnomon.yaml")
+	data := "api:\n  base_url: http://localhost:8080\n  proxy: http://proxy.example.com:3128\n  timeout: 45s\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.API.BaseURL != "http://localhost:8080" || cfg.API.Timeout != 45*time.Second {
+		t.Errorf("unexpected api configuration %+v", cfg.API)
+	}
+
+	if (API{BaseURL: "localhost:8080"}).Validate() == nil {
+		t.Error("expected a base url without a scheme to be invalid")
+	}
+}
+
+func TestReadInverters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnomon.yaml")
+	data := "inverters:\n  - sn: \"2102190001\"\n    ct_coil: 40\n    ct_group: stack\n  - sn: \"2102190002\"\n    ct_group: stack\n  - sn: \"2102190003\"\n    min_soc: 30\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Inverters) != 3 {
+		t.Fatalf("expected %d inverters, got %d", 3, len(cfg.Inverters))
+	}
+	if cfg.Inverters[0].Ct == nil || *cfg.Inverters[0].Ct != 40 {
+		t.Errorf("unexpected inverter configuration %+v", cfg.Inverters[0])
+	}
+	if group := cfg.Inverters.Group("stack"); len(group) != 2 || group[1] != "2102190002" {
+		t.Errorf("unexpected CT group %v", group)
+	}
+
+	if (Inverters{{SN: "1"}, {SN: "1"}}).Validate() == nil {
+		t.Error("expected a repeated serial number to be invalid")
+	}
+}
+
+func TestReadNotificationEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnomon.yaml")
+	data := "notifications:\n  events: [threshold_changed, grid_outage]\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A misspelt event would silently never be sent.
+	data = "notifications:\n  events: [threshold_change]\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Error("expected an unknown event to be invalid")
+	}
+}
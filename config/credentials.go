@@ -0,0 +1,66 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "fmt"
+
+// Credential providers.
+const (
+	// EnvCredentials reads the credentials from environment variables.
+	EnvCredentials = "env"
+	// FileCredentials reads the credentials from files, e.g. Docker or Kubernetes secrets.
+	FileCredentials = "file"
+	// SecretServiceCredentials reads the password from the Linux secret service.
+	SecretServiceCredentials = "secret-service"
+)
+
+// Credentials specifies where gnomon finds the credentials for the SunSynk API.
+// If no provider is specified, the credentials in the synkctl config file are used.
+// Any credential that a provider doesn't supply is also taken from the synkctl
+// config file.
+type Credentials struct {
+	// Provider is "env", "file" or "secret-service".
+	Provider string `yaml:"provider"`
+	// User is the SunSynk user; for the env provider it is the name of the
+	// variable holding the user (default GNOMON_USER).
+	User string `yaml:"user"`
+	// Password is the name of the variable holding the password for the env
+	// provider (default GNOMON_PASSWORD).
+	Password string `yaml:"password"`
+	// UserFile and PasswordFile are the files holding the user and password for
+	// the file provider.
+	UserFile     string `yaml:"user_file"`
+	PasswordFile string `yaml:"password_file"`
+	// Service is the value of the "service" attribute of the password in the
+	// secret service (default sunsynk).
+	Service string `yaml:"service"`
+}
+
+// Validate checks that the provider is known and fully specified.
+func (c Credentials) Validate() error {
+	switch c.Provider {
+	case "", EnvCredentials, SecretServiceCredentials:
+		return nil
+	case FileCredentials:
+		if c.PasswordFile == "" {
+			return fmt.Errorf("the %s credentials provider must have a password_file", c.Provider)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown credentials provider %q", c.Provider)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "fmt"
+
+// Inverter configures one of several inverters managed by a single gnomon process.
+// Unset bounds are taken from the command line flags.
+type Inverter struct {
+	// SN is the inverter's serial number.
+	SN string `yaml:"sn"`
+	// Modbus configures communication with this inverter over Modbus; the
+	// SunSynk API is used if the URL is empty.
+	Modbus Modbus `yaml:"modbus"`
+	// MinSoc is the minimum battery discharge threshold.
+	MinSoc *int `yaml:"min_soc"`
+	// MaxSoc is the maximum battery discharge threshold.
+	MaxSoc *int `yaml:"max_soc"`
+	// DeltaSoc is the maximum change to the battery discharge threshold.
+	DeltaSoc *int `yaml:"delta_soc"`
+	// Ct is the maximum discharge threshold for managing the CT coil; zero to not
+	// manage the coil.
+	Ct *int `yaml:"ct_coil"`
+	// CtGroup names a parallel stack. The CT coils of inverters in the same group
+	// are switched together using the combined power and lowest SoC of the group.
+	CtGroup string `yaml:"ct_group"`
+}
+
+// Inverters lists the inverters to manage. The synkctl config's default inverter
+// is managed if the list is empty.
+type Inverters []Inverter
+
+// Validate checks that each inverter has a unique serial number and that its
+// settings are in range.
+func (inverters Inverters) Validate() error {
+	seen := map[string]bool{}
+	for i, inv := range inverters {
+		if inv.SN == "" {
+			return fmt.Errorf("inverters entry %d: an inverter must have a serial number", i+1)
+		}
+		if seen[inv.SN] {
+			return fmt.Errorf("inverter %s is listed more than once", inv.SN)
+		}
+		seen[inv.SN] = true
+		for _, soc := range []*int{inv.MinSoc, inv.MaxSoc, inv.DeltaSoc, inv.Ct} {
+			if soc != nil && (*soc < 0 || *soc > 100) {
+				return fmt.Errorf("inverter %s: battery SoC must be in the range 0-100, not %d", inv.SN, *soc)
+			}
+		}
+		if inv.MinSoc != nil && inv.MaxSoc != nil && *inv.MinSoc > *inv.MaxSoc {
+			return fmt.Errorf("inverter %s: minimum SoC (%d%%) is greater than the maximum SoC (%d%%)", inv.SN, *inv.MinSoc, *inv.MaxSoc)
+		}
+		if err := inv.Modbus.Validate(); err != nil {
+			return fmt.Errorf("inverter %s: %w", inv.SN, err)
+		}
+	}
+	return nil
+}
+
+// Group returns the serial numbers of the inverters in a CT group in the order
+// that they are listed.
+func (inverters Inverters) Group(name string) []string {
+	sns := []string{}
+	for _, inv := range inverters {
+		if name != "" && inv.CtGroup == name {
+			sns = append(sns, inv.SN)
+		}
+	}
+	return sns
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Modbus configures communication with the inverter over Modbus instead of the
+// SunSynk API.
+type Modbus struct {
+	// URL is the inverter's Modbus address: tcp://host:port for a Modbus TCP gateway,
+	// rtu:///dev/ttyUSB0 for an RS485 adapter, rtu+tcp://host:port for a gateway
+	// that passes RTU frames over TCP or solarman://host:8899 for a Solarman Wi-Fi
+	// data logger. Modbus isn't used if the URL is empty.
+	URL string `yaml:"url"`
+	// LoggerSerial is the serial number of a Solarman data logger.
+	LoggerSerial uint32 `yaml:"logger_serial"`
+	// SlaveID is the inverter's Modbus address (default 1).
+	SlaveID int `yaml:"slave_id"`
+	// BaudRate is the speed of an RS485 adapter (default 9600).
+	BaudRate int `yaml:"baud_rate"`
+	// Timeout bounds each Modbus request (default 5s).
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks that the URL has a known scheme and that the settings are in range.
+func (m Modbus) Validate() error {
+	if m.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp", "rtu+tcp":
+		if u.Host == "" {
+			return fmt.Errorf("modbus url %s must have a host", m.URL)
+		}
+	case "solarman":
+		if u.Host == "" {
+			return fmt.Errorf("modbus url %s must have a host", m.URL)
+		}
+		if m.LoggerSerial == 0 {
+			return fmt.Errorf("the serial number of the Solarman logger at %s must be configured", m.URL)
+		}
+	case "rtu":
+		if u.Path == "" {
+			return fmt.Errorf("modbus url %s must have a device path", m.URL)
+		}
+	default:
+		return fmt.Errorf("modbus url %s must have a tcp, rtu, rtu+tcp or solarman scheme", m.URL)
+	}
+	if m.SlaveID < 0 || m.SlaveID > 247 {
+		return fmt.Errorf("modbus slave id must be in the range 1-247, not %d", m.SlaveID)
+	}
+	if m.BaudRate < 0 || m.Timeout < 0 {
+		return fmt.Errorf("modbus baud rate and timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Actions for CT coil windows.
+const (
+	// Off windows are times when the inverter must power only the essential loads.
+	Off = "off"
+	// Allow windows are the only times when the inverter may power all loads.
+	Allow = "allow"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a daily period, in 24 hour HH:MM format, that restricts when the CT coil
+// may be switched on. A window can wrap around midnight. If Days is empty, the window
+// applies to every day; otherwise Days lists the days (mon, tue, ...) that the window
+// applies to.
+type Window struct {
+	Action string   `yaml:"action"`
+	Start  string   `yaml:"start"`
+	End    string   `yaml:"end"`
+	Days   []string `yaml:"days"`
+}
+
+func (w Window) String() string {
+	s := fmt.Sprintf("%s window %s-%s", w.Action, w.Start, w.End)
+	if len(w.Days) > 0 {
+		s += " on " + strings.Join(w.Days, ",")
+	}
+	return s
+}
+
+func parseClock(s string) (string, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return "", fmt.Errorf("%s is not in the form HH:MM", s)
+	}
+	return t.Format("15:04"), nil
+}
+
+// Validate checks that the window is well-formed.
+func (w Window) Validate() error {
+	if w.Action != Off && w.Action != Allow {
+		return fmt.Errorf("window action must be %s or %s, not %q", Off, Allow, w.Action)
+	}
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	for _, d := range w.Days {
+		if !slices.Contains(weekdays, strings.ToLower(d)) {
+			return fmt.Errorf("%q is not a day, must be one of %s", d, strings.Join(weekdays, ", "))
+		}
+	}
+	return nil
+}
+
+// Contains returns true if the time t is within the window. The day of a window
+// that wraps around midnight is the day on which the window starts.
+func (w Window) Contains(t time.Time) bool {
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	clock := t.Format("15:04")
+	day := t
+	if start <= end {
+		if clock < start || clock >= end {
+			return false
+		}
+	} else {
+		if clock < start && clock >= end {
+			return false
+		}
+		if clock < end {
+			day = t.AddDate(0, 0, -1)
+		}
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(w.Days, func(d string) bool {
+		return strings.ToLower(d) == weekdays[day.Weekday()]
+	})
+}
+
+// Windows is a list of windows restricting when the CT coil may be switched on.
+type Windows []Window
+
+// Validate checks that all the windows are well-formed.
+func (ws Windows) Validate() error {
+	for i, w := range ws {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("ct_windows entry %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Blocking returns the window that prevents the CT coil from being switched on at
+// the time t. The CT coil can't be switched on during an off window or, if there are
+// any allow windows, outside all of the allow windows. Blocking returns false if
+// the CT coil may be switched on.
+func (ws Windows) Blocking(t time.Time) (string, bool) {
+	for _, w := range ws {
+		if w.Action == Off && w.Contains(t) {
+			return w.String(), true
+		}
+	}
+	allows := []string{}
+	for _, w := range ws {
+		if w.Action == Allow {
+			if w.Contains(t) {
+				return "", false
+			}
+			allows = append(allows, w.String())
+		}
+	}
+	if len(allows) > 0 {
+		return "outside " + strings.Join(allows, " and "), true
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package credentials supplies the user and password that gnomon uses to
+// authenticate with the SunSynk API.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+// Credentials are a SunSynk user and password. An empty field means that the
+// value in the synkctl config file should be used.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// Provider supplies credentials.
+type Provider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// Env reads the credentials from environment variables.
+type Env struct {
+	UserVar     string
+	PasswordVar string
+}
+
+// Credentials returns the values of the environment variables. An error is
+// returned if the password variable isn't set.
+func (e Env) Credentials(ctx context.Context) (Credentials, error) {
+	password, ok := os.LookupEnv(e.PasswordVar)
+	if !ok {
+		return Credentials{}, fmt.Errorf("environment variable %s is not set", e.PasswordVar)
+	}
+	return Credentials{User: os.Getenv(e.UserVar), Password: password}, nil
+}
+
+// File reads the credentials from files such as Docker or Kubernetes secrets.
+// Leading and trailing whitespace is removed from the contents of the files.
+type File struct {
+	User         string
+	UserFile     string
+	PasswordFile string
+}
+
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Credentials returns the contents of the files.
+func (f File) Credentials(ctx context.Context) (Credentials, error) {
+	creds := Credentials{User: f.User}
+	if f.UserFile != "" {
+		user, err := readSecret(f.UserFile)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds.User = user
+	}
+	password, err := readSecret(f.PasswordFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if password == "" {
+		return Credentials{}, fmt.Errorf("password file %s is empty", f.PasswordFile)
+	}
+	creds.Password = password
+	return creds, nil
+}
+
+// SecretService reads the password from the Linux secret service (e.g. GNOME
+// Keyring or KWallet) using the secret-tool command. The password is looked up
+// by its "service" attribute and, if a user is specified, its "username" attribute.
+// A password can be stored with
+//
+//	secret-tool store --label=SunSynk service sunsynk username <user>
+type SecretService struct {
+	User    string
+	Service string
+}
+
+// Credentials looks up the password in the secret service.
+func (s SecretService) Credentials(ctx context.Context) (Credentials, error) {
+	args := []string{"lookup", "service", s.Service}
+	if s.User != "" {
+		args = append(args, "username", s.User)
+	}
+	cmd := exec.CommandContext(ctx, "secret-tool", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("can't read password from the secret service: %w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	password := strings.TrimRight(string(out), "\n")
+	if password == "" {
+		return Credentials{}, errors.New("no password found in the secret service")
+	}
+	return Credentials{User: s.User, Password: password}, nil
+}
+
+// New returns the provider specified by the configuration or nil if the credentials
+// in the synkctl config file should be used.
+func New(cfg config.Credentials) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case config.EnvCredentials:
+		e := Env{UserVar: cfg.User, PasswordVar: cfg.Password}
+		if e.UserVar == "" {
+			e.UserVar = "GNOMON_USER"
+		}
+		if e.PasswordVar == "" {
+			e.PasswordVar = "GNOMON_PASSWORD"
+		}
+		return e, nil
+	case config.FileCredentials:
+		return File{User: cfg.User, UserFile: cfg.UserFile, PasswordFile: cfg.PasswordFile}, nil
+	case config.SecretServiceCredentials:
+		s := SecretService{User: cfg.User, Service: cfg.Service}
+		if s.Service == "" {
+			s.Service = "sunsynk"
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown credentials provider %q", cfg.Provider)
+}
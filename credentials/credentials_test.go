@@ -0,0 +1,55 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestEnv(t *testing.T) {
+	p, err := New(config.Credentials{Provider: config.EnvCredentials})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GNOMON_USER", "user@example.com")
+	t.Setenv("GNOMON_PASSWORD", "secret")
+	creds, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.User != "user@example.com" || creds.Password != "secret" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	p = Env{UserVar: "GNOMON_USER", PasswordVar: "GNOMON_TEST_UNSET_PASSWORD"}
+	if _, err = p.Credentials(context.Background()); err == nil {
+		t.Error("expected an error for an unset password variable")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(config.Credentials{Provider: config.FileCredentials, User: "user@example.com", PasswordFile: passwordFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.User != "user@example.com" || creds.Password != "secret" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	p = File{PasswordFile: filepath.Join(dir, "missing")}
+	if _, err = p.Credentials(context.Background()); err == nil {
+		t.Error("expected an error for a missing password file")
+	}
+}
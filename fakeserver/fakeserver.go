@@ -0,0 +1,392 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeserver is a local stand-in for the SunSynk API. It serves the
+// endpoints that synkctl's REST client uses (authentication, the inverter's
+// realtime input, battery, load and grid readings, the inverter's settings and
+// details) from scriptable state and can inject faults, so that gnomon can be
+// run and tested without a SunSynk account.
+package fakeserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// DefaultSN is the serial number of the inverter that a new server manages.
+const DefaultSN = "2102199999"
+
+// Values of the sysWorkMode setting. The setting is the inverter's load limit so
+// the values match those of the load limit register in the modbus package.
+const (
+	// essentialOnly limits the inverter to powering the essential loads.
+	essentialOnly = "1"
+	// allLoads lets the inverter power the non-essential loads through the CT coil
+	// without exporting to the grid.
+	allLoads = "2"
+)
+
+// Inverter is the scriptable state of a fake inverter.
+type Inverter struct {
+	// State is the reading returned by the realtime endpoints. The current time is
+	// reported if the state's time is zero.
+	State api.State
+	// Settings are the inverter's settings as returned by the settings endpoint.
+	Settings map[string]any
+	// RatedPower is the inverter's rated power in watts.
+	RatedPower int
+	// Model, Firmware and Plant are reported when the account's inverters are listed.
+	Model    string
+	Firmware string
+	Plant    string
+}
+
+func newInverter() *Inverter {
+	return &Inverter{
+		State: api.State{Power: 1500, Soc: 60, Load: 800, GridVoltage: 230, PV: []api.MPPT{{Power: 900, Voltage: 320}, {Power: 600, Voltage: 300}}},
+		Settings: map[string]any{
+			"batteryCap":    "40",
+			"batteryLowCap": "20",
+			"sysWorkMode":   essentialOnly,
+		},
+		RatedPower: 5000,
+		Model:      "SUN-5K-SG01LP1",
+		Firmware:   "3.3.8.9",
+		Plant:      "Fake plant",
+	}
+}
+
+// Server is a fake SunSynk API. The zero value isn't usable; use New.
+type Server struct {
+	mutex     sync.Mutex
+	user      string
+	password  string
+	inverters map[string]*Inverter
+	sns       []string
+	tokens    map[string]bool
+	faults    []*Fault
+	// TimeoutDelay is how long a request that times out is delayed if the client
+	// doesn't give up first.
+	TimeoutDelay time.Duration
+}
+
+// New returns a server managing inverters with the serial numbers sns (or DefaultSN
+// if none are given). If user is not empty, only the user and password are accepted
+// when authenticating.
+func New(user string, password string, sns ...string) *Server {
+	if len(sns) == 0 {
+		sns = []string{DefaultSN}
+	}
+	s := &Server{
+		user:         user,
+		password:     password,
+		inverters:    map[string]*Inverter{},
+		tokens:       map[string]bool{},
+		TimeoutDelay: 2 * time.Minute,
+	}
+	for _, sn := range sns {
+		s.inverters[sn] = newInverter()
+		s.sns = append(s.sns, sn)
+	}
+	return s
+}
+
+// SetState sets the reading returned for the inverter with serial number sn.
+func (s *Server) SetState(sn string, state api.State) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	inv, ok := s.inverters[sn]
+	if !ok {
+		return fmt.Errorf("unknown inverter %s", sn)
+	}
+	inv.State = state
+	return nil
+}
+
+// SetSetting sets one of the inverter's settings.
+func (s *Server) SetSetting(sn string, key string, value any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	inv, ok := s.inverters[sn]
+	if !ok {
+		return fmt.Errorf("unknown inverter %s", sn)
+	}
+	inv.Settings[key] = value
+	return nil
+}
+
+// Settings returns a copy of the inverter's settings.
+func (s *Server) Settings(sn string) map[string]any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	settings := map[string]any{}
+	if inv, ok := s.inverters[sn]; ok {
+		for k, v := range inv.Settings {
+			settings[k] = v
+		}
+	}
+	return settings
+}
+
+// Play steps the inverter's reading through the states, advancing one state every
+// interval, until the states are exhausted or the context is done. Each state is
+// reported with the time that it was played.
+func (s *Server) Play(ctx context.Context, sn string, states []api.State, interval time.Duration) error {
+	for i, state := range states {
+		state.Time = time.Now().Truncate(time.Second)
+		if err := s.SetState(sn, state); err != nil {
+			return err
+		}
+		if i == len(states)-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
+
+// envelope is the wrapper around every response from the SunSynk API.
+type envelope struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Data    any    `json:"data"`
+	Success bool   `json:"success"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, e envelope) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(e); err != nil {
+		log.Println("Failed to write response: ", err)
+	}
+}
+
+func ok(w http.ResponseWriter, data any) {
+	writeJSON(w, http.StatusOK, envelope{Code: 0, Msg: "Success", Data: data, Success: true})
+}
+
+func fail(w http.ResponseWriter, status int, code int, msg string) {
+	writeJSON(w, status, envelope{Code: code, Msg: msg, Success: false})
+}
+
+// route returns the name of the endpoint requested and the inverter's serial number.
+// The endpoint names are those used when injecting faults.
+func route(r *http.Request) (string, string) {
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPost && len(p) == 2 && p[0] == "oauth" && p[1] == "token":
+		return AuthEndpoint, ""
+	case len(p) < 3 || p[0] != "api" || p[1] != "v1":
+		return "", ""
+	case r.Method == http.MethodGet && len(p) == 3 && p[2] == "inverters":
+		return InvertersEndpoint, ""
+	case r.Method == http.MethodGet && len(p) == 6 && p[2] == "inverter" && p[4] == "realtime" && p[5] == "input":
+		return InputEndpoint, p[3]
+	case r.Method == http.MethodGet && len(p) == 6 && p[2] == "inverter" && p[5] == "realtime":
+		switch p[3] {
+		case "battery":
+			return BatteryEndpoint, p[4]
+		case "load":
+			return LoadEndpoint, p[4]
+		case "grid":
+			return GridEndpoint, p[4]
+		}
+	case r.Method == http.MethodGet && len(p) == 4 && p[2] == "inverter":
+		return DetailsEndpoint, p[3]
+	case len(p) == 6 && p[2] == "common" && p[3] == "setting":
+		if r.Method == http.MethodGet && p[5] == "read" {
+			return SettingsEndpoint, p[4]
+		}
+		if r.Method == http.MethodPost && p[5] == "set" {
+			return UpdateEndpoint, p[4]
+		}
+	}
+	return "", ""
+}
+
+// ServeHTTP serves the SunSynk API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, sn := route(r)
+	if endpoint == "" {
+		fail(w, http.StatusNotFound, 404, "not found")
+		return
+	}
+	if f := s.fault(endpoint); f != nil {
+		s.inject(w, r, f)
+		return
+	}
+	if endpoint == AuthEndpoint {
+		s.authenticate(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		fail(w, http.StatusUnauthorized, 401, "invalid_token")
+		return
+	}
+	if endpoint == InvertersEndpoint {
+		s.listInverters(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	inv, found := s.inverters[sn]
+	if !found {
+		fail(w, http.StatusOK, 1, fmt.Sprintf("inverter %s not found", sn))
+		return
+	}
+	switch endpoint {
+	case InputEndpoint:
+		ok(w, inputData(inv.State))
+	case BatteryEndpoint:
+		ok(w, map[string]any{
+			"soc":     strconv.Itoa(inv.State.Soc),
+			"power":   inv.State.BatteryPower,
+			"voltage": fmt.Sprint(inv.State.BatteryVoltage),
+			"temp":    fmt.Sprint(inv.State.BatteryTemperature),
+		})
+	case LoadEndpoint:
+		ok(w, map[string]any{"totalPower": inv.State.Load})
+	case GridEndpoint:
+		ok(w, map[string]any{
+			"pac": inv.State.GridPower,
+			"vip": []map[string]any{{"volt": fmt.Sprint(inv.State.GridVoltage), "current": "0", "power": inv.State.GridPower}},
+		})
+	case DetailsEndpoint:
+		ok(w, map[string]any{"sn": sn, "ratePower": inv.RatedPower})
+	case SettingsEndpoint:
+		ok(w, inv.Settings)
+	case UpdateEndpoint:
+		settings := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			fail(w, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+		for k, v := range settings {
+			inv.Settings[k] = v
+		}
+		ok(w, nil)
+	}
+}
+
+func inputData(state api.State) map[string]any {
+	t := state.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	pvs := []map[string]any{}
+	for i, pv := range state.PV {
+		pvs = append(pvs, map[string]any{
+			"pvNo": i + 1,
+			"ppv":  strconv.Itoa(pv.Power),
+			"vpv":  fmt.Sprint(pv.Voltage),
+			"time": t.Format(time.DateTime),
+		})
+	}
+	if len(pvs) == 0 {
+		pvs = append(pvs, map[string]any{"pvNo": 1, "ppv": "0", "vpv": "0", "time": t.Format(time.DateTime)})
+	}
+	return map[string]any{
+		"pac":  state.Power,
+		"temp": fmt.Sprint(state.InverterTemperature),
+		"pvIV": pvs,
+	}
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.user != "" && (req.Username != s.user || req.Password != s.password) {
+		fail(w, http.StatusOK, 102, "Incorrect username or password")
+		return
+	}
+	token := fmt.Sprintf("fake-token-%d", len(s.tokens)+1)
+	s.tokens[token] = true
+	ok(w, map[string]any{
+		"access_token":  token,
+		"token_type":    "bearer",
+		"refresh_token": token,
+		"expires_in":    3600,
+		"scope":         "all",
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tokens[token]
+}
+
+// RevokeTokens invalidates all access tokens so that clients must authenticate again.
+func (s *Server) RevokeTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+func (s *Server) listInverters(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = len(s.sns)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	infos := []map[string]any{}
+	for i := (page - 1) * limit; i < min(page*limit, len(s.sns)); i++ {
+		sn := s.sns[i]
+		inv := s.inverters[sn]
+		infos = append(infos, map[string]any{
+			"sn":        sn,
+			"alias":     "Fake " + sn,
+			"model":     inv.Model,
+			"status":    1,
+			"ratePower": inv.RatedPower,
+			"version":   map[string]any{"masterVer": inv.Firmware},
+			"plant":     map[string]any{"name": inv.Plant},
+		})
+	}
+	ok(w, map[string]any{"infos": infos, "total": len(s.sns)})
+}
@@ -0,0 +1,128 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+func request(t *testing.T, srv *httptest.Server, method string, path string, token string, body string) (int, envelope) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var e envelope
+	if err = json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, e
+}
+
+func login(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	_, e := request(t, srv, http.MethodPost, "/oauth/token", "", `{"username":"carl","password":"secret"}`)
+	if !e.Success {
+		t.Fatalf("expected to authenticate, got %q", e.Msg)
+	}
+	return e.Data.(map[string]any)["access_token"].(string)
+}
+
+func TestServer(t *testing.T) {
+	s := New("carl", "secret")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	if _, e := request(t, srv, http.MethodPost, "/oauth/token", "", `{"username":"carl","password":"wrong"}`); e.Success {
+		t.Error("expected authentication with the wrong password to fail")
+	}
+	if status, _ := request(t, srv, http.MethodGet, "/api/v1/inverter/battery/"+DefaultSN+"/realtime", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, status)
+	}
+
+	token := login(t, srv)
+	if err := s.SetState(DefaultSN, api.State{Soc: 73}); err != nil {
+		t.Fatal(err)
+	}
+	_, e := request(t, srv, http.MethodGet, "/api/v1/inverter/battery/"+DefaultSN+"/realtime", token, "")
+	if soc := e.Data.(map[string]any)["soc"]; soc != "73" {
+		t.Errorf("expected %q, got %v", "73", soc)
+	}
+
+	_, e = request(t, srv, http.MethodPost, "/api/v1/common/setting/"+DefaultSN+"/set", token, `{"batteryCap":"35"}`)
+	if !e.Success {
+		t.Errorf("expected the update to succeed, got %q", e.Msg)
+	}
+	if v := s.Settings(DefaultSN)["batteryCap"]; v != "35" {
+		t.Errorf("expected %q, got %v", "35", v)
+	}
+
+	s.RevokeTokens()
+	if status, _ := request(t, srv, http.MethodGet, "/api/v1/inverter/"+DefaultSN, token, ""); status != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, status)
+	}
+}
+
+func TestListInverters(t *testing.T) {
+	srv := httptest.NewServer(New("", "", "2102190001", "2102190002", "2102190003"))
+	defer srv.Close()
+	token := login(t, srv)
+
+	_, e := request(t, srv, http.MethodGet, "/api/v1/inverters?page=2&limit=2", token, "")
+	data := e.Data.(map[string]any)
+	if total := data["total"]; total != 3.0 {
+		t.Errorf("expected %d, got %v", 3, total)
+	}
+	infos := data["infos"].([]any)
+	if len(infos) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(infos))
+	}
+	if sn := infos[0].(map[string]any)["sn"]; sn != "2102190003" {
+		t.Errorf("expected %q, got %v", "2102190003", sn)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := New("", "")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	token := login(t, srv)
+
+	f, err := ParseFault("permission-denied:update:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Inject(f)
+	for i := 0; i < 2; i++ {
+		_, e := request(t, srv, http.MethodPost, "/api/v1/common/setting/"+DefaultSN+"/set", token, `{"sysWorkMode":"1"}`)
+		if e.Success || !strings.Contains(e.Msg, "permission") {
+			t.Errorf("expected a permission error, got %q", e.Msg)
+		}
+	}
+	_, e := request(t, srv, http.MethodGet, "/api/v1/common/setting/"+DefaultSN+"/read", token, "")
+	if !e.Success {
+		t.Errorf("expected reads to succeed, got %q", e.Msg)
+	}
+	_, e = request(t, srv, http.MethodPost, "/api/v1/common/setting/"+DefaultSN+"/set", token, `{"sysWorkMode":"1"}`)
+	if !e.Success {
+		t.Errorf("expected the fault to be exhausted, got %q", e.Msg)
+	}
+
+	for _, bad := range []string{"explode", "timeout:nowhere", "timeout:input:0", "timeout:input:1:2"} {
+		if _, err = ParseFault(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoints that faults can be injected into.
+const (
+	AuthEndpoint      = "auth"
+	InvertersEndpoint = "inverters"
+	InputEndpoint     = "input"
+	BatteryEndpoint   = "battery"
+	LoadEndpoint      = "load"
+	GridEndpoint      = "grid"
+	SettingsEndpoint  = "settings"
+	UpdateEndpoint    = "update"
+	DetailsEndpoint   = "details"
+)
+
+var endpoints = []string{AuthEndpoint, InvertersEndpoint, InputEndpoint, BatteryEndpoint, LoadEndpoint, GridEndpoint, SettingsEndpoint, UpdateEndpoint, DetailsEndpoint}
+
+// Kinds of fault.
+const (
+	// Unauthorized rejects the request's access token.
+	Unauthorized = "unauthorized"
+	// Timeout delays the response until the client gives up.
+	Timeout = "timeout"
+	// PermissionDenied reports that the account may not perform the request.
+	PermissionDenied = "permission-denied"
+	// ServerError responds with an internal server error.
+	ServerError = "server-error"
+)
+
+var kinds = []string{Unauthorized, Timeout, PermissionDenied, ServerError}
+
+// Fault is an error injected into responses from an endpoint.
+type Fault struct {
+	Kind string
+	// Endpoint is the endpoint that fails; all endpoints fail if it is empty.
+	Endpoint string
+	// Count is the number of requests that fail; zero means every request.
+	Count int
+}
+
+// ParseFault parses a fault in the form kind[:endpoint[:count]], e.g.
+// "unauthorized:input:3" or "timeout".
+func ParseFault(s string) (Fault, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return Fault{}, fmt.Errorf("%s is not in the form kind[:endpoint[:count]]", s)
+	}
+	f := Fault{Kind: parts[0]}
+	if !slices.Contains(kinds, f.Kind) {
+		return Fault{}, fmt.Errorf("unknown fault %q; must be one of %s", f.Kind, strings.Join(kinds, ", "))
+	}
+	if len(parts) > 1 {
+		f.Endpoint = parts[1]
+		if f.Endpoint != "" && !slices.Contains(endpoints, f.Endpoint) {
+			return Fault{}, fmt.Errorf("unknown endpoint %q; must be one of %s", f.Endpoint, strings.Join(endpoints, ", "))
+		}
+	}
+	if len(parts) > 2 {
+		count, err := strconv.Atoi(parts[2])
+		if err != nil || count < 1 {
+			return Fault{}, fmt.Errorf("fault count must be a positive integer, not %s", parts[2])
+		}
+		f.Count = count
+	}
+	return f, nil
+}
+
+func (f Fault) String() string {
+	s := f.Kind
+	if f.Endpoint != "" || f.Count > 0 {
+		s += ":" + f.Endpoint
+	}
+	if f.Count > 0 {
+		s += ":" + strconv.Itoa(f.Count)
+	}
+	return s
+}
+
+// Inject adds a fault. Faults are applied in the order that they were injected.
+func (s *Server) Inject(f Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// fault returns the first fault that applies to the endpoint, if any, and
+// counts the request against the fault.
+func (s *Server) fault(endpoint string) *Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.faults {
+		if f.Endpoint != "" && f.Endpoint != endpoint {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) inject(w http.ResponseWriter, r *http.Request, f *Fault) {
+	switch f.Kind {
+	case Unauthorized:
+		fail(w, http.StatusUnauthorized, 401, "invalid_token")
+	case PermissionDenied:
+		fail(w, http.StatusOK, 403, "No permission to perform this operation")
+	case ServerError:
+		fail(w, http.StatusInternalServerError, 500, "Internal server error")
+	case Timeout:
+		select {
+		case <-r.Context().Done():
+		case <-time.After(s.TimeoutDelay):
+			fail(w, http.StatusGatewayTimeout, 504, "Gateway timeout")
+		}
+	}
+}
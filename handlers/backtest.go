@@ -0,0 +1,257 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/audit"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/journal"
+)
+
+// BacktestOptions describes the simulated inverter and how gnomon should manage it.
+type BacktestOptions struct {
+	// Threshold is the battery discharge threshold at the start of the backtest.
+	Threshold int
+	// LowBatteryCapacity is the SoC that generates a low battery alarm.
+	LowBatteryCapacity int
+	// RatedPower is the rated power of the inverter.
+	RatedPower int
+	// MinSoc, MaxSoc, DeltaSoc, Ct, Schedule and CtWindows have the same meanings as in Options.
+	MinSoc    int
+	MaxSoc    int
+	DeltaSoc  int
+	Ct        int
+	Schedule  config.Schedule
+	CtWindows config.Windows
+}
+
+// Decision is a change that gnomon made to the simulated inverter's settings.
+type Decision struct {
+	Time    time.Time
+	Setting string
+	Old     string
+	New     string
+	Reason  string
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("%s %s: %s -> %s (%s)", d.Time.Format(time.DateTime), d.Setting, d.Old, d.New, d.Reason)
+}
+
+// virtualClock is a clock that is set to the time of the state being replayed.
+type virtualClock struct {
+	now time.Time
+}
+
+func (c *virtualClock) Now() time.Time {
+	return c.now
+}
+
+// simulatedInverter is an inverter whose settings are kept in memory. Like an
+// api.Inverter, it tells its observers about every read and write of its settings.
+type simulatedInverter struct {
+	clock              *virtualClock
+	threshold          int
+	lowBatteryCapacity int
+	ratedPower         int
+	essentialOnly      bool
+	observers          []*func(api.SettingEvent)
+}
+
+func (inv *simulatedInverter) notify(operation string, setting string, value any) {
+	e := api.SettingEvent{Time: inv.clock.Now(), Operation: operation, Setting: setting, Value: value}
+	for _, f := range inv.observers {
+		(*f)(e)
+	}
+}
+
+func (inv *simulatedInverter) SN() string {
+	return ""
+}
+
+func (inv *simulatedInverter) Authenticate(context.Context) error {
+	return nil
+}
+
+func (inv *simulatedInverter) ReadState(context.Context, *api.State) (bool, error) {
+	return false, errors.New("a simulated inverter's states are replayed")
+}
+
+func (inv *simulatedInverter) Poll(context.Context, time.Duration, chan api.State) {}
+
+func (inv *simulatedInverter) InverterRatedPower(context.Context) (int, error) {
+	return inv.ratedPower, nil
+}
+
+func (inv *simulatedInverter) BatteryDischargeThreshold(context.Context) (int, error) {
+	inv.notify(api.Read, api.BatteryCapacitySetting, inv.threshold)
+	return inv.threshold, nil
+}
+
+func (inv *simulatedInverter) LowBatteryCapacity(context.Context) (int, error) {
+	return inv.lowBatteryCapacity, nil
+}
+
+func (inv *simulatedInverter) EssentialOnly(context.Context) bool {
+	inv.notify(api.Read, api.EssentialOnlySetting, inv.essentialOnly)
+	return inv.essentialOnly
+}
+
+func (inv *simulatedInverter) UpdateBatteryCapacity(capacity int) error {
+	inv.threshold = capacity
+	inv.notify(api.Write, api.BatteryCapacitySetting, capacity)
+	return nil
+}
+
+func (inv *simulatedInverter) UpdateEssentialOnly(eo bool) error {
+	inv.essentialOnly = eo
+	inv.notify(api.Write, api.EssentialOnlySetting, eo)
+	return nil
+}
+
+func (inv *simulatedInverter) ObserveSettings(f func(api.SettingEvent)) func() {
+	o := &f
+	inv.observers = append(inv.observers, o)
+	return func() {
+		inv.observers = slices.DeleteFunc(inv.observers, func(x *func(api.SettingEvent)) bool { return x == o })
+	}
+}
+
+func (inv *simulatedInverter) SetJournal(*journal.File) {}
+
+// settingValue formats the value of a setting for a decision.
+func settingValue(setting string, v any) string {
+	if v == nil {
+		return "?"
+	}
+	if setting == api.BatteryCapacitySetting {
+		return fmt.Sprintf("%v%%", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// backtestDay runs gnomon's handlers over one day's states as if the day were a run
+// of gnomon. The decisions are appended to decisions.
+func backtestDay(inv *simulatedInverter, states []api.State, opts BacktestOptions, decisions *[]Decision) error {
+	minSoc, maxSoc, err := SocBounds(opts.MinSoc, opts.MaxSoc, opts.Schedule, opts.LowBatteryCapacity, states[0].Time)
+	if err != nil {
+		return fmt.Errorf("%s: %w", states[0].Time.Format(time.DateOnly), err)
+	}
+
+	// The unit records the changes to the settings, rather than auditing them, and
+	// doesn't log or notify.
+	u := &Unit{
+		Inverter:  inv,
+		logger:    log.New(io.Discard, "", 0),
+		overrides: newOverrideTracker(0),
+		grid:      &gridState{},
+		clock:     inv.clock,
+	}
+	u.overrides.logger = u.logger
+	u.overrides.notify = func(string, string, ...any) {}
+	u.recordChange = func(e audit.Entry) error {
+		// Writes that leave the CT coil as it was, e.g. at the end of a run in which
+		// the inverter only powered the essential loads, aren't decisions.
+		old := settingValue(e.Setting, e.OldValue)
+		value := settingValue(e.Setting, e.NewValue)
+		if e.Verified && (e.Setting != api.EssentialOnlySetting || old != value) {
+			*decisions = append(*decisions, Decision{e.Time, e.Setting, old, value, e.Reason})
+		}
+		return nil
+	}
+	unregister := inv.ObserveSettings(u.overrides.observe)
+	defer unregister()
+
+	ctx := context.Background()
+	inv.clock.now = states[0].Time
+	soc := newSocManager(u, minSoc, maxSoc, opts.DeltaSoc)
+	socDone := false
+	outage := &outageManager{u: u}
+	var coil *coilManager
+	if opts.Ct > 0 {
+		coil = newCoilManager(u, 0, opts.CtWindows)
+		if !coil.enabled(ctx, opts.Ct) {
+			coil.finish(ctx)
+			coil = nil
+		}
+	}
+
+	// The states are passed to the handlers in the order that gnomon's fanout does.
+	for _, s := range states {
+		inv.clock.now = s.Time
+		u.grid.update(s)
+		if !socDone && soc.handle(ctx, s) {
+			soc.finish(ctx)
+			socDone = true
+		}
+		outage.handle(ctx, s)
+		if coil != nil {
+			coil.handle(ctx, s)
+		}
+	}
+
+	if !socDone {
+		soc.finish(ctx)
+	}
+	if coil != nil {
+		coil.finish(ctx)
+	}
+	return nil
+}
+
+// Backtest replays recorded states through the handlers that gnomon uses to manage the
+// battery's depth of discharge, the CT coil and grid outages. The states are grouped
+// by day and each day is treated as a separate run of gnomon. The handlers' clock is
+// the time of the states and the inverter is simulated; Backtest returns every change
+// made to the inverter's settings.
+func Backtest(states []api.State, opts BacktestOptions) ([]Decision, error) {
+	states = append([]api.State{}, states...)
+	sort.SliceStable(states, func(i, j int) bool {
+		return states[i].Time.Before(states[j].Time)
+	})
+
+	inv := &simulatedInverter{
+		clock:              &virtualClock{},
+		threshold:          opts.Threshold,
+		lowBatteryCapacity: opts.LowBatteryCapacity,
+		ratedPower:         opts.RatedPower,
+		essentialOnly:      true,
+	}
+	decisions := []Decision{}
+	for start := 0; start < len(states); {
+		date := states[start].Time.Format(time.DateOnly)
+		end := start
+		for end < len(states) && states[end].Time.Format(time.DateOnly) == date {
+			end++
+		}
+		if err := backtestDay(inv, states[start:end], opts, &decisions); err != nil {
+			return nil, err
+		}
+		start = end
+	}
+	return decisions, nil
+}
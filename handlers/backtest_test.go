@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// sunnyDay returns a day's states in which the battery is fully charged by noon.
+func sunnyDay(date time.Time) []api.State {
+	states := []api.State{}
+	for i := 0; i <= 12*4; i++ {
+		t := date.Add(6*time.Hour + time.Duration(i)*15*time.Minute)
+		soc := min(40+5*i/2, 100)
+		power := 0
+		if hour := t.Hour(); hour >= 8 && hour < 16 {
+			power = 4000
+		}
+		states = append(states, api.State{Power: power, Soc: soc, GridVoltage: 230, Time: t})
+	}
+	return states
+}
+
+func TestBacktest(t *testing.T) {
+	date := time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC)
+	opts := BacktestOptions{Threshold: 40, LowBatteryCapacity: 10, RatedPower: 5000, MinSoc: -1, MaxSoc: -1, DeltaSoc: 5, Ct: 50}
+	decisions, err := Backtest(sunnyDay(date), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 3 {
+		t.Fatalf("expected 3 decisions, got %v", decisions)
+	}
+	if d := decisions[0]; d.Setting != api.EssentialOnlySetting || d.New != "false" {
+		t.Errorf("expected the inverter to power all loads, got %s", d)
+	}
+	if d := decisions[1]; d.Setting != api.BatteryCapacitySetting || d.Old != "40%" || d.New != "36%" || !strings.Contains(d.Reason, "peak SOC 100%") {
+		t.Errorf("expected the threshold to be lowered, got %s", d)
+	}
+	if d := decisions[2]; d.New != "true" || d.Reason != "ctcoil: end of run" {
+		t.Errorf("expected the inverter to power only the essential loads, got %s", d)
+	}
+}
+
+func TestBacktestOutage(t *testing.T) {
+	date := time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC)
+	states := sunnyDay(date)
+	// The grid is down from 10:00 to 11:00.
+	for i := range states {
+		if h := states[i].Time.Hour(); h == 10 {
+			states[i].GridVoltage = 0
+		}
+	}
+	opts := BacktestOptions{Threshold: 40, LowBatteryCapacity: 10, RatedPower: 5000, MinSoc: -1, MaxSoc: -1, DeltaSoc: 5, Ct: 50}
+	decisions, err := Backtest(states, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outage := false
+	for _, d := range decisions {
+		if strings.HasPrefix(d.Reason, "outage:") {
+			outage = true
+			if d.Time.Hour() != 10 || d.New != "true" {
+				t.Errorf("expected the inverter to power only the essential loads at 10:00, got %s", d)
+			}
+		}
+		if d.Setting == api.BatteryCapacitySetting && (d.New != "40%" || !strings.HasSuffix(d.Reason, ", grid outage")) {
+			t.Errorf("expected the threshold not to be lowered after an outage, got %s", d)
+		}
+	}
+	if !outage {
+		t.Errorf("expected a decision for the outage, got %v", decisions)
+	}
+
+	// The battery's SoC bounds are checked for each day.
+	opts.MinSoc = 5
+	if _, err = Backtest(states, opts); err == nil {
+		t.Error("expected an error for a minimum SoC below the low battery capacity")
+	}
+}
@@ -18,11 +18,13 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/notify"
 )
 
 func average(l []int) int {
@@ -92,46 +94,63 @@ func shouldSwitchOff(averagePower int, inverterPower int, soc int, thresholdSoc
 	return !shouldSwitchOn(averagePower, inverterPower, soc, thresholdSoc)
 }
 
-func handleEssentialOnly(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int) {
+// coilReason returns the audit log's reason for switching the CT coil based on the
+// SoC and input power.
+func coilReason(averagePower int, inverterPower int, soc int, threshold int) string {
+	return fmt.Sprintf("ctcoil: SOC %d%%, average power %dW, threshold %d%%, rated power %dW", soc, averagePower, threshold, inverterPower)
+}
+
+func (u *Unit) handleEssentialOnly(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int) {
 	if shouldSwitchOn(averagePower, inverterPower, soc, threshold) {
-		log.Println("Configuring inverter to power all loads")
-		if err := api.UpdateEssentialOnly(false); err != nil {
-			log.Println("Failed to enable CT coil: ", err)
-		}
-		for i := 0; i < 10; i++ {
-			if !api.EssentialOnly(ctx) {
-				log.Println("Successfully updated inverter")
-				return
-			}
-			time.Sleep(10 * time.Second)
+		u.logger.Println("Configuring inverter to power all loads")
+		if o := u.writeCoil(ctx, coilPolicy, false, coilReason(averagePower, inverterPower, soc, threshold)); o.Verified {
+			u.notify(notify.CtSwitched, "Inverter is powering all loads (SOC = %d%%, average power = %dW)", soc, averagePower)
 		}
-		log.Println("Failed to update inverter")
 	}
 }
 
-func handleAllLoads(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int) {
+func (u *Unit) switchToEssentialOnly(ctx context.Context, reason string) {
+	u.logger.Println("Configuring inverter to power only essential loads")
+	if o := u.writeCoil(ctx, coilPolicy, true, reason); o.Verified {
+		u.notify(notify.CtSwitched, "Inverter is powering only the essential loads")
+	}
+}
+
+func (u *Unit) handleAllLoads(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int) {
 	if shouldSwitchOff(averagePower, inverterPower, soc, threshold) {
-		log.Println("Configuring inverter to power only essential loads")
-		if err := api.UpdateEssentialOnly(true); err != nil {
-			log.Println("Failed to disable CT coil: ", err)
-		}
-		for i := 0; i < 10; i++ {
-			if api.EssentialOnly(ctx) {
-				log.Println("Successfully updated inverter")
-				return
-			}
-			time.Sleep(10 * time.Second)
-		}
-		log.Println("Failed to update inverter")
+		u.switchToEssentialOnly(ctx, coilReason(averagePower, inverterPower, soc, threshold))
+	}
+}
+
+// handleStaleState stops the inverter from powering the non-essential loads
+// when the inverter's data is too old to base decisions on.
+func (u *Unit) handleStaleState(ctx context.Context, age time.Duration) {
+	u.logger.Printf("Not managing the CT coil; inverter data is %s old\n", age.Round(time.Second))
+	if !u.Inverter.EssentialOnly(ctx) {
+		u.switchToEssentialOnly(ctx, fmt.Sprintf("ctcoil: inverter data is %s old", age.Round(time.Second)))
 	}
 }
 
-func manageCoil(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int) {
-	essentialOnly := api.EssentialOnly(ctx)
+// manageCoil decides whether the inverter should power all loads. If a window is
+// blocking the CT coil, the inverter may only power the essential loads.
+func (u *Unit) manageCoil(ctx context.Context, averagePower int, inverterPower int, soc int, threshold int, window string, blocked bool) {
+	essentialOnly := u.Inverter.EssentialOnly(ctx)
+	if u.coilOverridden() {
+		return
+	}
+	if blocked {
+		if !essentialOnly {
+			u.logger.Printf("Powering only the essential loads as required by the CT coil rules (%s)\n", window)
+			u.switchToEssentialOnly(ctx, fmt.Sprintf("ctcoil: blocked by CT coil rule (%s)", window))
+		} else if shouldSwitchOn(averagePower, inverterPower, soc, threshold) {
+			u.logger.Printf("Not powering all loads; blocked by the CT coil rules (%s)\n", window)
+		}
+		return
+	}
 	if essentialOnly {
-		handleEssentialOnly(ctx, averagePower, inverterPower, soc, threshold)
+		u.handleEssentialOnly(ctx, averagePower, inverterPower, soc, threshold)
 	} else {
-		handleAllLoads(ctx, averagePower, inverterPower, soc, threshold)
+		u.handleAllLoads(ctx, averagePower, inverterPower, soc, threshold)
 	}
 }
 
@@ -140,13 +159,13 @@ type powerTime struct {
 	t     time.Time
 }
 
-func newPowerTime(power int) powerTime {
-	return powerTime{power, time.Now()}
+func newPowerTime(power int, t time.Time) powerTime {
+	return powerTime{power, t}
 }
 
-func getRecentPowerReadings(powerTimes *[]powerTime) []int {
+func getRecentPowerReadings(powerTimes *[]powerTime, now time.Time) []int {
 	for {
-		if (*powerTimes)[0].t.After(time.Now().Add(-20 * time.Minute)) {
+		if len(*powerTimes) == 0 || (*powerTimes)[0].t.After(now.Add(-20*time.Minute)) {
 			break
 		}
 		*powerTimes = (*powerTimes)[1:]
@@ -158,71 +177,117 @@ func getRecentPowerReadings(powerTimes *[]powerTime) []int {
 	return powers
 }
 
-// CtCoilHandler enables or disables power flowing from the inverter to non-essential
-// circuits depending on the battery's SoC and the input power.
-func CtCoilHandler(ctx context.Context, minBatterySoc int, wg *sync.WaitGroup, ch chan api.State) {
-	log.Println("Starting power management to the CT")
-	defer wg.Done()
-	defer func() {
-		log.Println("Configuring inverter to power only the essential loads")
-		for i := 0; i < 10; i++ {
-			err := api.UpdateEssentialOnly(true)
-			if err != nil {
-				log.Println("Failed to update inverter's settings: ", err)
-			}
-			time.Sleep(30 * time.Second)
-			if api.EssentialOnly(context.Background()) {
-				break
-			}
-		}
-		log.Println("Finished power management to the CT")
-	}()
+// coilManager decides whether the inverter powers the non-essential loads through
+// the CT coil.
+type coilManager struct {
+	u             *Unit
+	staleLimit    time.Duration
+	windows       config.Windows
+	started       bool
+	inverterPower int
+	threshold     int
+	powerReadings []powerTime
+}
 
+func newCoilManager(u *Unit, staleLimit time.Duration, windows config.Windows) *coilManager {
+	return &coilManager{u: u, staleLimit: staleLimit, windows: windows, powerReadings: []powerTime{}}
+}
+
+// enabled returns true if the CT coil should be managed. It isn't managed if the
+// battery's discharge threshold is above minBatterySoc.
+func (m *coilManager) enabled(ctx context.Context, minBatterySoc int) bool {
+	u := m.u
 	for {
-		batteryCap, err := api.BatteryDischargeThreshold(ctx)
+		batteryCap, err := u.Inverter.BatteryDischargeThreshold(ctx)
 		if err != nil {
-			log.Println("Failed to read battery discharge threshold: ", err)
+			u.logger.Println("Failed to read battery discharge threshold: ", err)
 			time.Sleep(30 * time.Second)
 			continue
 		}
 		if batteryCap > minBatterySoc {
-			log.Printf("Battery discharge threshold (%d%%) is above the minimum SoC (%d%%), disabling CT coil management\n", batteryCap, minBatterySoc)
-			return
+			u.logger.Printf("Battery discharge threshold (%d%%) is above the minimum SoC (%d%%), disabling CT coil management\n", batteryCap, minBatterySoc)
+			return false
 		}
-		break
+		return true
 	}
+}
 
-	powerReadings := []powerTime{}
-	var inverterPower int
-	var threshold int
-	var err error
-	for {
-		select {
-		case <-ch:
-			inverterPower, err = api.InverterRatedPower(ctx)
-			if err != nil {
-				log.Println("Failed to read inverter's rated power: ", err)
-				continue
-			}
-			threshold, err = api.BatteryDischargeThreshold(ctx)
-			if err != nil {
-				log.Println("Failed to read discharge threshold: ", err)
-				continue
-			}
-		case <-ctx.Done():
+// handle updates the manager with a state and switches the CT coil if necessary. The
+// inverter's rated power and discharge threshold are read when the first state is
+// handled.
+func (m *coilManager) handle(ctx context.Context, s api.State) {
+	u := m.u
+	if !m.started {
+		var err error
+		m.inverterPower, err = u.ratedPower(ctx)
+		if err != nil {
+			u.logger.Println("Failed to read inverter's rated power: ", err)
 			return
 		}
-		break
+		m.threshold, err = u.Inverter.BatteryDischargeThreshold(ctx)
+		if err != nil {
+			u.logger.Println("Failed to read discharge threshold: ", err)
+			return
+		}
+		m.started = true
+		return
 	}
 
+	now := u.clock.Now()
+	if age := now.Sub(s.Time); m.staleLimit > 0 && age > m.staleLimit {
+		u.handleStaleState(ctx, age)
+		return
+	}
+	// The outage manager powers only the essential loads during a grid outage.
+	if down, _ := u.grid.down(); down {
+		return
+	}
+	if u.group != nil {
+		u.group.update(u, s)
+		s = u.group.combine(u, s)
+	}
+	m.powerReadings = append(m.powerReadings, newPowerTime(s.Power, now))
+	averagePower := average(getRecentPowerReadings(&m.powerReadings, now))
+	window, blocked := m.windows.Blocking(s.Time)
+	u.manageCoil(ctx, averagePower, m.inverterPower, s.Soc, m.threshold, window, blocked)
+}
+
+// finish configures the inverter to power only the essential loads at the end of a
+// run unless the CT coil was configured manually.
+func (m *coilManager) finish(ctx context.Context) {
+	u := m.u
+	if u.coilOverridden() {
+		u.logger.Println("Leaving the CT coil as it was manually configured")
+		return
+	}
+	u.logger.Println("Configuring inverter to power only the essential loads")
+	u.writeCoil(ctx, coilCleanupPolicy, true, "ctcoil: end of run")
+}
+
+// CtCoilHandler enables or disables power flowing from the inverter to non-essential
+// circuits depending on the battery's SoC and the input power. If the inverter's data
+// is older than staleLimit, the inverter powers only the essential circuits. The
+// windows restrict the times when the inverter may power the non-essential circuits.
+// If the unit leads a CT group, the CT coils of all the inverters in the group are
+// switched together based on the group's combined power and lowest SoC.
+func CtCoilHandler(ctx context.Context, u *Unit, minBatterySoc int, staleLimit time.Duration, windows config.Windows, wg *sync.WaitGroup, ch chan api.State) {
+	u.logger.Println("Starting power management to the CT")
+	defer wg.Done()
+	m := newCoilManager(u, staleLimit, windows)
+	defer func() {
+		m.finish(ctx)
+		u.logger.Println("Finished power management to the CT")
+	}()
+
+	if !m.enabled(ctx, minBatterySoc) {
+		return
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case s := <-ch:
-			powerReadings = append(powerReadings, newPowerTime(s.Power))
-			averagePower := average(getRecentPowerReadings(&powerReadings))
-			manageCoil(ctx, averagePower, inverterPower, s.Soc, threshold)
+			m.handle(ctx, s)
 		}
 	}
 }
@@ -18,20 +18,19 @@ package handlers
 
 import (
 	"context"
-	"log"
 
 	"github.com/hammingweight/gnomon/api"
 )
 
 // DisplayHandler displays the state of the inverter whenever it changes.
-func DisplayHandler(ctx context.Context, ch chan api.State) {
-	defer log.Println("Finished displaying inverter state")
+func DisplayHandler(ctx context.Context, u *Unit, ch chan api.State) {
+	defer u.logger.Println("Finished displaying inverter state")
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case state := <-ch:
-			log.Println(state)
+			u.logger.Println(state)
 		}
 	}
 }
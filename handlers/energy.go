@@ -0,0 +1,188 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/history"
+)
+
+// maxSampleGap is the longest interval between two readings that will be
+// integrated; the power during a longer gap is unknown so it is ignored.
+const maxSampleGap = time.Hour
+
+// EnergyMeter integrates the power readings reported by the inverter into daily
+// energy totals and tracks the battery's SoC and the CT coil's setting. The grid
+// outages are taken from a unit's grid state.
+type EnergyMeter struct {
+	mutex             sync.Mutex
+	last              *api.State
+	lastEssentialOnly bool
+	grid              *gridState
+	days              []history.Day
+}
+
+// NewEnergyMeter returns an EnergyMeter with no readings that reports the outages
+// recorded in grid.
+func NewEnergyMeter(grid *gridState) *EnergyMeter {
+	return &EnergyMeter{grid: grid, days: []history.Day{}}
+}
+
+// energyBetween uses the trapezoidal rule to estimate the energy between
+// two readings.
+func energyBetween(prev api.State, cur api.State) history.Energy {
+	hours := cur.Time.Sub(prev.Time).Hours()
+	integrate := func(p1 int, p2 int) float64 {
+		return float64(p1+p2) / 2 * hours
+	}
+	e := history.Energy{
+		PV:   integrate(prev.Power, cur.Power),
+		Load: integrate(prev.Load, cur.Load),
+	}
+	if grid := integrate(prev.GridPower, cur.GridPower); grid > 0 {
+		e.GridImport = grid
+	} else {
+		e.GridExport = -grid
+	}
+	if battery := integrate(prev.BatteryPower, cur.BatteryPower); battery > 0 {
+		e.BatteryDischarge = battery
+	} else {
+		e.BatteryCharge = -battery
+	}
+	return e
+}
+
+func (m *EnergyMeter) day(t time.Time) *history.Day {
+	date := t.Format(time.DateOnly)
+	for i := range m.days {
+		if m.days[i].Date == date {
+			return &m.days[i]
+		}
+	}
+	m.days = append(m.days, history.Day{Date: date, MinSoc: 100})
+	return &m.days[len(m.days)-1]
+}
+
+// Add adds a reading to the meter. essentialOnly is whether the inverter was
+// powering only the essential loads when the reading was taken.
+func (m *EnergyMeter) Add(s api.State, essentialOnly bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.last != nil && !s.Time.After(m.last.Time) {
+		return
+	}
+	d := m.day(s.Time)
+	d.MinSoc = min(d.MinSoc, s.Soc)
+	d.MaxSoc = max(d.MaxSoc, s.Soc)
+	if m.last != nil {
+		if essentialOnly != m.lastEssentialOnly {
+			d.Switches++
+		}
+		gap := s.Time.Sub(m.last.Time)
+		if gap <= maxSampleGap {
+			e := energyBetween(*m.last, s)
+			d.Energy = d.Energy.Add(e)
+			// The CT coil's setting during the interval is the setting at the
+			// start of the interval.
+			if m.lastEssentialOnly {
+				d.EssentialOnly = d.EssentialOnly.Add(e)
+			} else {
+				d.AllLoads = d.AllLoads.Add(e)
+				d.CtOnSeconds += gap.Seconds()
+			}
+		}
+	}
+	m.last = &s
+	m.lastEssentialOnly = essentialOnly
+}
+
+// Days returns the energy totals for each day along with the outages that started
+// on the day. An outage that hasn't ended is treated as ending at the time of the
+// last state.
+func (m *EnergyMeter) Days() []history.Day {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	days := make([]history.Day, len(m.days))
+	copy(days, m.days)
+	for _, outage := range m.grid.list() {
+		for i := range days {
+			if days[i].Date == outage.Start.Format(time.DateOnly) {
+				days[i].Outages = append(slices.Clip(days[i].Outages), outage)
+			}
+		}
+	}
+	return days
+}
+
+// coilSetting is the CT coil's setting as last read or written by gnomon.
+type coilSetting struct {
+	mutex         sync.Mutex
+	known         bool
+	essentialOnly bool
+}
+
+// observe updates the setting with a read or write of the CT coil's setting.
+func (c *coilSetting) observe(e api.SettingEvent) {
+	if e.Setting != api.EssentialOnlySetting {
+		return
+	}
+	eo, ok := e.Value.(bool)
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.known = true
+	c.essentialOnly = eo
+}
+
+// value returns the setting and whether it has been read or written.
+func (c *coilSetting) value() (bool, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.essentialOnly, c.known
+}
+
+// EnergyHandler integrates the inverter's power readings into energy totals. The
+// CT coil's setting is taken from the reads and writes of the setting rather than
+// being read from the inverter for every reading; it's only read if it hasn't
+// been seen yet.
+func EnergyHandler(ctx context.Context, u *Unit, meter *EnergyMeter, ch chan api.State) {
+	defer u.logger.Println("Finished energy accounting")
+	coil := &coilSetting{}
+	unregister := u.Inverter.ObserveSettings(coil.observe)
+	defer unregister()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-ch:
+			essentialOnly, ok := coil.value()
+			if !ok {
+				essentialOnly = u.Inverter.EssentialOnly(ctx)
+			}
+			meter.Add(s, essentialOnly)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+func TestEnergyMeter(t *testing.T) {
+	start := time.Date(2025, 5, 23, 12, 0, 0, 0, time.UTC)
+	m := NewEnergyMeter(&gridState{})
+	m.Add(api.State{Power: 1000, Load: 500, Soc: 80, GridPower: 0, BatteryPower: -500, Time: start}, true)
+	m.Add(api.State{Power: 2000, Load: 500, Soc: 90, GridPower: 0, BatteryPower: -1500, Time: start.Add(30 * time.Minute)}, false)
+	m.Add(api.State{Power: 2000, Load: 2500, Soc: 85, GridPower: 500, BatteryPower: 0, Time: start.Add(60 * time.Minute)}, false)
+
+	days := m.Days()
+	if len(days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(days))
+	}
+	d := days[0]
+	if d.Date != "2025-05-23" {
+		t.Errorf("expected 2025-05-23, got %s", d.Date)
+	}
+	if math.Abs(d.Energy.PV-1750) > 0.01 {
+		t.Errorf("expected 1750Wh of PV energy, got %f", d.Energy.PV)
+	}
+	if math.Abs(d.EssentialOnly.PV-750) > 0.01 {
+		t.Errorf("expected 750Wh of PV energy while essential only, got %f", d.EssentialOnly.PV)
+	}
+	if math.Abs(d.AllLoads.Load-750) > 0.01 {
+		t.Errorf("expected 750Wh of load energy while powering all loads, got %f", d.AllLoads.Load)
+	}
+	if math.Abs(d.Energy.BatteryCharge-875) > 0.01 {
+		t.Errorf("expected 875Wh of battery charge, got %f", d.Energy.BatteryCharge)
+	}
+	if math.Abs(d.Energy.GridImport-125) > 0.01 {
+		t.Errorf("expected 125Wh of grid import, got %f", d.Energy.GridImport)
+	}
+	if d.MinSoc != 80 || d.MaxSoc != 90 {
+		t.Errorf("expected SoC range 80-90%%, got %d-%d%%", d.MinSoc, d.MaxSoc)
+	}
+	if d.Switches != 1 {
+		t.Errorf("expected 1 switch, got %d", d.Switches)
+	}
+	if d.CtOnSeconds != 1800 {
+		t.Errorf("expected CT coil on for 1800s, got %f", d.CtOnSeconds)
+	}
+
+	// Gaps that are too long aren't integrated.
+	m.Add(api.State{Power: 2000, Time: start.Add(3 * time.Hour)}, false)
+	if pv := m.Days()[0].Energy.PV; math.Abs(pv-1750) > 0.01 {
+		t.Errorf("expected 1750Wh of PV energy, got %f", pv)
+	}
+}
+
+func TestEnergyMeterOutages(t *testing.T) {
+	start := time.Date(2025, 5, 23, 12, 0, 0, 0, time.UTC)
+	grid := &gridState{}
+	m := NewEnergyMeter(grid)
+	add := func(s api.State) {
+		grid.update(s)
+		m.Add(s, true)
+	}
+	add(api.State{GridVoltage: 230, GridPower: 100, Time: start})
+	add(api.State{GridVoltage: 0, GridPower: 0, Time: start.Add(5 * time.Minute)})
+	add(api.State{GridVoltage: 0, GridPower: 0, Time: start.Add(10 * time.Minute)})
+	add(api.State{GridVoltage: 231, GridPower: 50, Time: start.Add(65 * time.Minute)})
+	add(api.State{GridVoltage: 0, GridPower: 0, Time: start.Add(70 * time.Minute)})
+	add(api.State{GridVoltage: 0, GridPower: 0, Time: start.Add(80 * time.Minute)})
+
+	outages := m.Days()[0].Outages
+	if len(outages) != 2 {
+		t.Fatalf("expected 2 outages, got %d", len(outages))
+	}
+	if outages[0].Seconds != 3600 {
+		t.Errorf("expected a 3600s outage, got %f", outages[0].Seconds)
+	}
+	if outages[1].Seconds != 600 {
+		t.Errorf("expected an ongoing 600s outage, got %f", outages[1].Seconds)
+	}
+
+	// Outages aren't detected if the inverter doesn't report the grid voltage.
+	grid = &gridState{}
+	m = NewEnergyMeter(grid)
+	add(api.State{Time: start})
+	add(api.State{Time: start.Add(5 * time.Minute)})
+	if len(m.Days()[0].Outages) != 0 {
+		t.Error("expected no outages")
+	}
+}
+
+func TestCoilSetting(t *testing.T) {
+	c := &coilSetting{}
+	if _, ok := c.value(); ok {
+		t.Error("expected the setting to be unknown")
+	}
+	c.observe(api.SettingEvent{Operation: api.Write, Setting: api.EssentialOnlySetting, Value: false})
+	c.observe(api.SettingEvent{Operation: api.Write, Setting: api.BatteryCapacitySetting, Value: 35})
+	if eo, ok := c.value(); !ok || eo {
+		t.Errorf("expected %t, got %t", false, eo)
+	}
+	c.observe(api.SettingEvent{Operation: api.Read, Setting: api.EssentialOnlySetting, Value: true})
+	if eo, _ := c.value(); !eo {
+		t.Errorf("expected %t, got %t", true, eo)
+	}
+}
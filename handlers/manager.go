@@ -20,12 +20,21 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/audit"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/history"
+	"github.com/hammingweight/gnomon/journal"
+	"github.com/hammingweight/gnomon/modbus"
+	"github.com/hammingweight/gnomon/notify"
+	"github.com/hammingweight/gnomon/recorder"
 )
 
 func setupLogging(logfile string) (*os.File, error) {
@@ -41,10 +50,139 @@ func setupLogging(logfile string) (*os.File, error) {
 	return f, nil
 }
 
-// ManageInverter spawns handlers to respond to changes in the inverter's state.
-func ManageInverter(logfile string, delay time.Duration, runTime time.Duration, configFile string, minSoc int, deltaSoc int, ct int) error {
+// Options specifies how ManageInverter should manage the inverter.
+type Options struct {
+	// Logfile is the path of the log file; logs are written to stderr if empty.
+	Logfile string
+	// Delay is how long to wait before managing the inverter.
+	Delay time.Duration
+	// RunTime is how long to manage the inverter.
+	RunTime time.Duration
+	// ConfigFile is the path of the synkctl configuration file.
+	ConfigFile string
+	// JournalFile is the path of the crash recovery journal; no journal is kept if empty.
+	JournalFile string
+	// HistoryFile is the path of the file recording a summary of each run; no history is kept if empty.
+	HistoryFile string
+	// AuditFile is the path of the file recording every change to the inverter's settings;
+	// no changes are recorded if empty.
+	AuditFile string
+	// RecordDir is the directory for recordings of the inverter's states; nothing is recorded if empty.
+	RecordDir string
+	// RecordFormat is the format of the recordings, recorder.CSV or recorder.JSONLines.
+	RecordFormat string
+	// Location is the timezone of the times reported by the inverter.
+	Location *time.Location
+	// StaleLimit is the age after which the inverter's data is considered stale.
+	StaleLimit time.Duration
+	// MinSoc is the minimum battery discharge threshold; negative to use the default.
+	MinSoc int
+	// MaxSoc is the maximum battery discharge threshold; negative to use the default.
+	MaxSoc int
+	// DeltaSoc is the maximum change to the battery discharge threshold.
+	DeltaSoc int
+	// Schedule bounds the battery discharge threshold by time of year.
+	Schedule config.Schedule
+	// Notifications configures where events are sent.
+	Notifications config.Notifications
+	// CtWindows restricts when the CT coil may be switched on.
+	CtWindows config.Windows
+	// OverrideBackoff is how long to stop managing a setting that was changed manually;
+	// zero means for the rest of the run.
+	OverrideBackoff time.Duration
+	// Ct is the maximum discharge threshold for managing the CT coil; zero to not manage the coil.
+	Ct int
+	// Inverter is the serial number of the inverter to manage; the synkctl config's
+	// default inverter is managed if it is empty and Inverters is empty. If Inverters
+	// isn't empty, only the listed inverter with this serial number is managed.
+	Inverter string
+	// Modbus configures access to the inverter over Modbus if Inverters is empty.
+	Modbus config.Modbus
+	// Inverters lists the inverters to manage; the synkctl config's default inverter
+	// is managed if the list is empty.
+	Inverters config.Inverters
+}
+
+// forInverter returns the options for one of several inverters. The inverter's own
+// settings override the settings for all inverters.
+func (opts Options) forInverter(inv config.Inverter) Options {
+	if inv.MinSoc != nil {
+		opts.MinSoc = *inv.MinSoc
+	}
+	if inv.MaxSoc != nil {
+		opts.MaxSoc = *inv.MaxSoc
+	}
+	if inv.DeltaSoc != nil {
+		opts.DeltaSoc = *inv.DeltaSoc
+	}
+	if inv.Ct != nil {
+		opts.Ct = *inv.Ct
+	}
+	return opts
+}
+
+// managed returns the configured inverters that are managed: all of them or, if
+// opts.Inverter is set, only the selected inverter.
+func (opts Options) managed() config.Inverters {
+	if opts.Inverter == "" {
+		return opts.Inverters
+	}
+	for _, inv := range opts.Inverters {
+		if inv.SN == opts.Inverter {
+			return config.Inverters{inv}
+		}
+	}
+	return config.Inverters{}
+}
+
+// newUnits returns a unit for each of the managed inverters, or for opts.Inverter
+// if none are configured. Managed inverters in the same CT group are grouped so
+// that their CT coils are switched together. If several inverters are configured,
+// each unit has its own files even if only one of them is managed.
+func newUnits(opts Options) ([]*Unit, error) {
+	if len(opts.Inverters) == 0 {
+		u, err := NewUnit(opts.Inverter, opts.Modbus)
+		if err != nil {
+			return nil, err
+		}
+		return []*Unit{u}, nil
+	}
+
+	managed := opts.managed()
+	units := []*Unit{}
+	bySN := map[string]*Unit{}
+	clients := map[string]*modbus.Client{}
+	for _, inv := range managed {
+		u, err := newUnit(inv.SN, inv.Modbus, clients)
+		if err != nil {
+			return nil, err
+		}
+		u.several = len(opts.Inverters) > 1
+		units = append(units, u)
+		bySN[inv.SN] = u
+	}
+	for i, inv := range managed {
+		if inv.CtGroup == "" || units[i].group != nil {
+			continue
+		}
+		members := []*Unit{}
+		for _, sn := range opts.Inverters.Group(inv.CtGroup) {
+			if member, ok := bySN[sn]; ok {
+				members = append(members, member)
+			}
+		}
+		if len(members) > 1 {
+			newCtGroup(members)
+		}
+	}
+	return units, nil
+}
+
+// ManageInverter spawns handlers to respond to changes in the state of each of the
+// inverters. Each inverter is managed independently unless it is in a CT group.
+func ManageInverter(opts Options) error {
 	// Set up logging
-	f, err := setupLogging(logfile)
+	f, err := setupLogging(opts.Logfile)
 	if err != nil {
 		return err
 	}
@@ -54,52 +192,214 @@ func ManageInverter(logfile string, delay time.Duration, runTime time.Duration,
 		}
 	}()
 
+	// Record every change to the inverters' settings.
+	audit.SetFile(opts.AuditFile)
+
+	// Set up notifications and wait for them to be delivered before exiting.
+	notify.Configure(opts.Notifications)
+	defer notify.Wait()
+
+	units, err := newUnits(opts)
+	if err != nil {
+		return err
+	}
+	api.SetLocation(opts.Location)
+	api.SetConfigFile(opts.ConfigFile)
+
+	// Restore the inverters' settings if the previous run didn't exit cleanly. This is
+	// done before waiting to start so that the inverters aren't left in the state that
+	// the previous run left them in for the duration of the delay.
+	if opts.JournalFile != "" {
+		reconcileUnits(units, opts)
+	}
+
 	// Wait...
-	if delay >= 5*time.Second {
-		log.Printf("Waiting for %s to start...\n", delay)
+	if opts.Delay >= 5*time.Second {
+		log.Printf("Waiting for %s to start...\n", opts.Delay)
 	}
-	time.Sleep(delay)
+	time.Sleep(opts.Delay)
 	log.Println("Starting management of the inverter")
 
 	// Set up a context that will expire after the specified timeout, at which point this code
 	// will stop managing the inverter.
 	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, runTime)
+	ctx, cancel := context.WithTimeout(ctx, opts.RunTime)
 	defer cancel()
 
+	errs := make([]error, len(units))
+	wg := &sync.WaitGroup{}
+	for i, u := range units {
+		unitOpts := opts
+		if len(opts.Inverters) > 0 {
+			unitOpts = opts.forInverter(opts.managed()[i])
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errs[i] = manageUnit(ctx, u, unitOpts); errs[i] != nil {
+				u.logger.Println("Failed to manage inverter: ", errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// reconcileUnits restores the settings of each inverter whose journal shows that the
+// previous run didn't exit cleanly. Failures are logged since a journal that is
+// left behind is reconciled again when the inverter's management starts.
+func reconcileUnits(units []*Unit, opts Options) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.RunTime)
+	defer cancel()
+	for _, u := range units {
+		if err := u.Inverter.Authenticate(ctx); err != nil {
+			u.logger.Println("Failed to reconcile inverter settings: ", err)
+			continue
+		}
+		if _, err := Reconcile(ctx, u, u.path(opts.JournalFile)); err != nil {
+			u.logger.Println("Failed to reconcile inverter settings: ", err)
+		}
+	}
+}
+
+// manageUnit manages one inverter until the context is done or its handlers finish.
+func manageUnit(ctx context.Context, u *Unit, opts Options) error {
+	started := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Watch for manual changes to the inverter's settings.
+	u.trackOverrides(opts.OverrideBackoff)
+
+	// Read the battery's discharge threshold before any changes are made.
+	if err := u.Inverter.Authenticate(ctx); err != nil {
+		return err
+	}
+	startThreshold, err := u.Inverter.BatteryDischargeThreshold(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check that the bounds on the battery's discharge threshold are valid for this inverter.
+	lowBatteryCap, err := u.Inverter.LowBatteryCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	minSoc, maxSoc, err := SocBounds(opts.MinSoc, opts.MaxSoc, opts.Schedule, lowBatteryCap, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Restore the inverter's settings if the journal couldn't be reconciled before the
+	// start delay and then record the settings before any changes are made.
+	if opts.JournalFile != "" {
+		journalFile := u.path(opts.JournalFile)
+		reconciled, err := Reconcile(ctx, u, journalFile)
+		if err != nil {
+			u.logger.Println("Failed to reconcile inverter settings: ", err)
+		}
+		if reconciled {
+			if startThreshold, err = u.Inverter.BatteryDischargeThreshold(ctx); err != nil {
+				return err
+			}
+		}
+		original := journal.Settings{BatteryCapacity: startThreshold, EssentialOnly: u.Inverter.EssentialOnly(ctx)}
+		jnl, err := journal.Open(journalFile, original)
+		if err != nil {
+			return err
+		}
+		u.Inverter.SetJournal(jnl)
+		defer func() {
+			if err := jnl.Close(); err != nil {
+				u.logger.Println("Failed to remove journal: ", err)
+			}
+		}()
+	}
+
 	// Add a handler to display the inverter's statistics.
 	displayChan := make(chan api.State)
-	go DisplayHandler(ctx, displayChan)
+	go DisplayHandler(ctx, u, displayChan)
 
 	// Add a handler to manage the battery's depth of discharge.
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	socChan := make(chan api.State)
-	go SocHandler(ctx, wg, minSoc, deltaSoc, socChan)
+	go SocHandler(ctx, u, wg, minSoc, maxSoc, opts.DeltaSoc, socChan)
+
+	// Add a handler to measure the energy flows.
+	meter := NewEnergyMeter(u.grid)
+	energyChan := make(chan api.State)
+	go EnergyHandler(ctx, u, meter, energyChan)
+
+	// Add a handler to respond to grid outages.
+	outageChan := make(chan api.State)
+	go OutageHandler(ctx, u, outageChan)
 
 	// A slice of channels with handlers to respond to state changes.
-	chans := []chan api.State{displayChan, socChan}
+	chans := []chan api.State{displayChan, socChan, energyChan, outageChan}
+
+	// If the user wants the inverter's states to be recorded, add a handler. Each
+	// of several inverters is recorded in its own subdirectory.
+	if opts.RecordDir != "" {
+		dir := opts.RecordDir
+		if u.several {
+			dir = filepath.Join(dir, u.sn)
+		}
+		rec, err := recorder.New(dir, opts.RecordFormat)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+		recordChan := make(chan api.State)
+		go RecorderHandler(ctx, u, rec, recordChan)
+		chans = append(chans, recordChan)
+	}
 
 	// If the user wants gnomon to enable/disable power to the non-essential circuits,
-	// add a handler.
-	if ct > 0 {
+	// add a handler. Only the leader of a CT group manages the group's CT coils; the
+	// other inverters in the group pass their states to the leader.
+	if u.leader() && opts.Ct > 0 {
 		wg.Add(1)
 		ctChan := make(chan api.State)
-		go CtCoilHandler(ctx, ct, wg, ctChan)
+		go CtCoilHandler(ctx, u, opts.Ct, opts.StaleLimit, opts.CtWindows, wg, ctChan)
 		chans = append(chans, ctChan)
+	} else if !u.leader() {
+		groupChan := make(chan api.State)
+		go GroupHandler(ctx, u, groupChan)
+		chans = append(chans, groupChan)
 	}
 
-	// Create a fanout channel that will relay messages to the handler channels.
-	fanout := Fanout(chans...)
+	// Create a fanout channel that will relay messages to the handler channels. The
+	// unit's grid state is updated before the states are relayed.
+	fanout := u.watchGrid(ctx, Fanout(chans...))
 
 	// Start polling and sending messages to the handlers when there are changes in state.
-	go api.Poll(ctx, configFile, fanout)
+	go u.Inverter.Poll(ctx, opts.StaleLimit, fanout)
 
 	wg.Wait()
 	if ctx.Err() != nil {
-		log.Println("Deadline has expired; exiting")
+		u.logger.Println("Deadline has expired; exiting")
 	} else {
-		log.Println("Handlers have finished managing the inverter; exiting early")
+		u.logger.Println("Handlers have finished managing the inverter; exiting early")
+	}
+	cancel()
+
+	// Report the energy totals and record them in the history.
+	run := history.Run{Started: started, Finished: time.Now(), Inverter: u.sn, StartThreshold: startThreshold, Days: meter.Days()}
+	endCtx, endCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer endCancel()
+	if run.EndThreshold, err = u.Inverter.BatteryDischargeThreshold(endCtx); err != nil {
+		u.logger.Println("Failed to read discharge threshold: ", err)
+		run.EndThreshold = history.UnknownThreshold
+	}
+	for _, d := range run.Days {
+		u.logger.Printf("Energy on %s: %s\n", d.Date, d.Energy)
+		u.logger.Printf("Energy on %s while powering all loads: %s\n", d.Date, d.AllLoads)
+	}
+	if opts.HistoryFile != "" {
+		if err = history.Append(opts.HistoryFile, run); err != nil {
+			u.logger.Println("Failed to update history: ", err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,182 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/history"
+	"github.com/hammingweight/gnomon/notify"
+)
+
+// gridOutageVoltage is the grid voltage below which the grid is considered to be down.
+const gridOutageVoltage = 150.0
+
+// outageDetector detects when the grid goes down and when it is restored. Not all
+// inverters report the grid voltage so outages are only detected once a grid
+// voltage has been seen.
+type outageDetector struct {
+	seenVoltage bool
+	down        bool
+	start       time.Time
+}
+
+// update updates the detector with a new state and returns true if the state
+// shows that the grid has gone down or has been restored.
+func (d *outageDetector) update(s api.State) bool {
+	if s.GridVoltage > 0 {
+		d.seenVoltage = true
+	}
+	if !d.seenVoltage {
+		return false
+	}
+	down := s.GridVoltage < gridOutageVoltage && s.GridPower == 0
+	if down == d.down {
+		return false
+	}
+	d.down = down
+	if down {
+		d.start = s.Time
+	}
+	return true
+}
+
+// gridState is a unit's record of grid outages. It is updated with every state that
+// is polled from the inverter, before the state is relayed to the handlers, so the
+// handlers agree about whether the grid is down even if they miss some states.
+type gridState struct {
+	mutex    sync.Mutex
+	detector outageDetector
+	outages  []history.Outage
+	last     time.Time
+}
+
+// update updates the grid state with a new inverter state.
+func (g *gridState) update(s api.State) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !s.Time.After(g.last) {
+		return
+	}
+	if g.detector.update(s) && !g.detector.down {
+		start := g.detector.start
+		g.outages = append(g.outages, history.Outage{Start: start, End: s.Time, Seconds: s.Time.Sub(start).Seconds()})
+	}
+	g.last = s.Time
+}
+
+// down returns whether the grid is down and, if it is, when the outage started.
+func (g *gridState) down() (bool, time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.detector.down, g.detector.start
+}
+
+// occurred returns whether the grid has been down at any time.
+func (g *gridState) occurred() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.detector.down || len(g.outages) > 0
+}
+
+// list returns the outages. An outage that hasn't ended is treated as ending at the
+// time of the last state.
+func (g *gridState) list() []history.Outage {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	outages := make([]history.Outage, len(g.outages))
+	copy(outages, g.outages)
+	if g.detector.down {
+		start := g.detector.start
+		outages = append(outages, history.Outage{Start: start, End: g.last, Seconds: g.last.Sub(start).Seconds()})
+	}
+	return outages
+}
+
+// watchGrid returns a channel that updates the unit's grid state with each state that
+// it receives and then sends the state to ch.
+func (u *Unit) watchGrid(ctx context.Context, ch chan api.State) chan api.State {
+	in := make(chan api.State)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-in:
+				u.grid.update(s)
+				select {
+				case ch <- s:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return in
+}
+
+// outageManager configures the inverter to power only the essential loads when the
+// grid goes down.
+type outageManager struct {
+	u       *Unit
+	wasDown bool
+}
+
+// handle reports a change in the unit's grid state. The state s is the state that was
+// polled with, or after, the change.
+func (m *outageManager) handle(ctx context.Context, s api.State) {
+	u := m.u
+	down, start := u.grid.down()
+	if down == m.wasDown {
+		return
+	}
+	m.wasDown = down
+	if down {
+		u.logger.Println("Grid outage detected")
+		u.notify(notify.GridOutage, "Grid outage detected at %s (battery SOC = %d%%)", start.Format(time.DateTime), s.Soc)
+		if !u.Inverter.EssentialOnly(ctx) {
+			reason := fmt.Sprintf("outage: grid voltage %.0fV", s.GridVoltage)
+			u.logger.Println(u.writeEssentialOnly(ctx, coilPolicy, true, reason))
+		}
+		return
+	}
+	duration := s.Time.Sub(start).Round(time.Minute)
+	u.logger.Printf("Grid restored after %s\n", duration)
+	u.notify(notify.GridRestored, "Grid restored at %s after %s (battery SOC = %d%%)", s.Time.Format(time.DateTime), duration, s.Soc)
+}
+
+// OutageHandler watches for the grid going down. During an outage, the inverter is
+// configured to power only the essential loads so that the non-essential loads don't
+// drain the battery.
+func OutageHandler(ctx context.Context, u *Unit, ch chan api.State) {
+	defer u.logger.Println("Finished monitoring the grid")
+	m := &outageManager{u: u}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-ch:
+			m.handle(ctx, s)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/notify"
+)
+
+// settleTime is how long the SunSynk API may keep reporting a setting's old value
+// after gnomon changes it.
+const settleTime = 5 * time.Minute
+
+// overrideTracker detects changes to the inverter's settings that were not made by
+// gnomon, e.g. changes made in the SunSynk app, by comparing the values read from
+// the inverter with the values that gnomon last read or wrote.
+type overrideTracker struct {
+	mutex     sync.Mutex
+	logger    *log.Logger
+	notify    func(event string, format string, args ...any)
+	backoff   time.Duration
+	expected  map[string]any
+	writtenAt map[string]time.Time
+	until     map[string]time.Time
+}
+
+func newOverrideTracker(backoff time.Duration) *overrideTracker {
+	return &overrideTracker{
+		logger:    log.Default(),
+		notify:    notify.Notify,
+		backoff:   backoff,
+		expected:  map[string]any{},
+		writtenAt: map[string]time.Time{},
+		until:     map[string]time.Time{},
+	}
+}
+
+// observe updates the tracker with a read or write of a setting.
+func (o *overrideTracker) observe(e api.SettingEvent) {
+	if e.Setting != api.BatteryCapacitySetting && e.Setting != api.EssentialOnlySetting {
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	expected, ok := o.expected[e.Setting]
+	o.expected[e.Setting] = e.Value
+	if e.Operation == api.Write {
+		o.writtenAt[e.Setting] = e.Time
+		return
+	}
+	if !ok || expected == e.Value {
+		return
+	}
+	if e.Time.Sub(o.writtenAt[e.Setting]) < settleTime {
+		// The API may still be reporting the value from before gnomon's change.
+		o.expected[e.Setting] = expected
+		return
+	}
+
+	period := "the rest of the run"
+	o.until[e.Setting] = time.Time{}
+	if o.backoff > 0 {
+		period = o.backoff.String()
+		o.until[e.Setting] = e.Time.Add(o.backoff)
+	}
+	o.logger.Printf("Manual override of %s detected (%v -> %v); not managing it for %s\n", e.Setting, expected, e.Value, period)
+	o.notify(notify.ManualOverride, "Manual override of %s detected (%v -> %v); not managing it for %s", e.Setting, expected, e.Value, period)
+}
+
+// last returns the value of the setting that gnomon last read or wrote.
+func (o *overrideTracker) last(setting string) (any, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	v, ok := o.expected[setting]
+	return v, ok
+}
+
+// active returns true if gnomon should not change the setting because it was
+// changed manually.
+func (o *overrideTracker) active(setting string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	until, ok := o.until[setting]
+	if !ok {
+		return false
+	}
+	if until.IsZero() || time.Now().Before(until) {
+		return true
+	}
+	delete(o.until, setting)
+	o.logger.Printf("Resuming management of %s\n", setting)
+	return false
+}
+
+// trackOverrides starts tracking manual changes to the inverter's settings. After a
+// manual change, gnomon stops managing the setting for the backoff period or, if the
+// backoff is zero, for the rest of the run.
+func (u *Unit) trackOverrides(backoff time.Duration) {
+	u.overrides = newOverrideTracker(backoff)
+	u.overrides.logger = u.logger
+	u.overrides.notify = u.notify
+	u.Inverter.ObserveSettings(u.overrides.observe)
+}
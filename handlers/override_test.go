@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+func TestOverrideTracker(t *testing.T) {
+	o := newOverrideTracker(time.Hour)
+	now := time.Now()
+	read := func(t time.Time, v any) {
+		o.observe(api.SettingEvent{Time: t, Operation: api.Read, Setting: api.EssentialOnlySetting, Value: v})
+	}
+
+	read(now.Add(-2*time.Hour), true)
+	o.observe(api.SettingEvent{Time: now.Add(-90 * time.Minute), Operation: api.Write, Setting: api.EssentialOnlySetting, Value: false})
+
+	// The API may report the old value for a while after a write.
+	read(now.Add(-89*time.Minute), true)
+	if o.active(api.EssentialOnlySetting) {
+		t.Error("expected no override while the write settles")
+	}
+	read(now.Add(-80*time.Minute), false)
+	if o.active(api.EssentialOnlySetting) {
+		t.Error("expected no override after gnomon's write")
+	}
+
+	// A change that gnomon didn't make is an override.
+	read(now.Add(-30*time.Minute), true)
+	if !o.active(api.EssentialOnlySetting) {
+		t.Error("expected an override")
+	}
+
+	// An override detected more than the backoff period ago has expired.
+	o = newOverrideTracker(time.Hour)
+	read(now.Add(-3*time.Hour), true)
+	read(now.Add(-2*time.Hour), false)
+	if o.active(api.EssentialOnlySetting) {
+		t.Error("expected the override to have expired")
+	}
+
+	// Other settings aren't affected.
+	if o.active(api.BatteryCapacitySetting) {
+		t.Error("expected no override of the battery capacity")
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/recorder"
+)
+
+// RecorderHandler records every state of the inverter and every read or write of
+// the inverter's settings.
+func RecorderHandler(ctx context.Context, u *Unit, rec *recorder.Recorder, ch chan api.State) {
+	defer u.logger.Println("Finished recording inverter state")
+	unregister := u.Inverter.ObserveSettings(func(e api.SettingEvent) {
+		if err := rec.RecordSetting(e); err != nil {
+			u.logger.Println("Failed to record setting: ", err)
+		}
+	})
+	defer unregister()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-ch:
+			if err := rec.RecordState(s); err != nil {
+				u.logger.Println("Failed to record state: ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/audit"
+	"github.com/hammingweight/gnomon/journal"
+)
+
+// Reconcile checks whether the journal at journalFile shows that a previous run
+// of gnomon exited without restoring the inverter's settings. If so, the inverter
+// is returned to the safe settings recorded in the journal and the journal is
+// removed. Reconcile returns false if there was nothing to reconcile.
+func Reconcile(ctx context.Context, u *Unit, journalFile string) (bool, error) {
+	jnl, err := journal.Read(journalFile)
+	if err != nil {
+		return false, err
+	}
+	if jnl == nil {
+		return false, nil
+	}
+
+	u.logger.Printf("Found journal from a run started at %s (pid %d) that did not exit cleanly\n", jnl.Started.Format(time.DateTime), jnl.Pid)
+	safe := jnl.SafeSettings()
+
+	if !u.Inverter.EssentialOnly(ctx) {
+		u.logger.Println("Configuring inverter to power only the essential loads")
+		if o := u.writeEssentialOnly(ctx, restorePolicy, safe.EssentialOnly, "recover: restoring settings from journal"); !o.Verified {
+			return false, o.Err
+		}
+	}
+
+	threshold, err := u.Inverter.BatteryDischargeThreshold(ctx)
+	if err != nil {
+		return false, err
+	}
+	if threshold != safe.BatteryCapacity {
+		u.logger.Printf("Restoring battery's minimum SOC from %d%% to %d%%\n", threshold, safe.BatteryCapacity)
+		if o := u.writeBatteryCapacity(ctx, restorePolicy, safe.BatteryCapacity, "recover: restoring settings from journal"); !o.Verified {
+			return false, o.Err
+		}
+	}
+
+	u.logger.Println("Inverter settings have been reconciled")
+	return true, journal.Remove(journalFile)
+}
+
+// RecoverInverter authenticates with the SunSynk API and reconciles the settings of
+// each of the inverters whose journal shows that gnomon did not exit cleanly. Changes
+// to the settings are recorded in the audit file. Only the Logfile, ConfigFile,
+// JournalFile, AuditFile, Modbus and Inverters options are used.
+func RecoverInverter(opts Options) error {
+	f, err := setupLogging(opts.Logfile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	audit.SetFile(opts.AuditFile)
+	api.SetConfigFile(opts.ConfigFile)
+	units, err := newUnits(opts)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	errs := []error{}
+	for _, u := range units {
+		u.trackOverrides(0)
+		if err = u.Inverter.Authenticate(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reconciled, err := Reconcile(ctx, u, u.path(opts.JournalFile))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !reconciled {
+			u.logger.Println("No journal found; the last run of gnomon exited cleanly")
+		}
+	}
+	return errors.Join(errs...)
+}
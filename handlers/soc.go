@@ -18,75 +18,58 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"math"
 	"sync"
 	"time"
 
 	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/notify"
 )
 
-// SocHandler watches the battery's SoC and determines how to adjust the depth of
-// discharge of the battery.
-func SocHandler(ctx context.Context, wg *sync.WaitGroup, minSoc int, deltaSoc int, ch chan api.State) {
-	log.Println("Starting management of the battery SOC")
-	defer wg.Done()
-	defer log.Println("Finished management of the battery SOC")
-
-	var threshold int
-	var err error
-	for {
-		select {
-		case <-ch:
-			threshold, err = api.BatteryDischargeThreshold(ctx)
-			if err != nil {
-				log.Println("Failed to read discharge threshold: ", err)
-				continue
-			}
-			var lowBatteryCap int
-			lowBatteryCap, err = api.LowBatteryCapacity(ctx)
-			if err != nil {
-				log.Println("Failed to read low battery capacity: ", err)
-				continue
-			}
-			if minSoc < 0 {
-				minSoc = lowBatteryCap + 20
-			} else if minSoc < lowBatteryCap {
-				log.Printf("Specified minimum battery SOC = %d%% is too low\n", minSoc)
-				minSoc = lowBatteryCap
-			}
-			log.Printf("Minimum allowed battery SOC threshold = %d%%\n", minSoc)
-			log.Printf("Maximum change to battery SOC threshold = %d%%\n", deltaSoc)
-		case <-ctx.Done():
-			return
+// SocBounds returns the lowest and highest battery discharge thresholds that gnomon
+// may set on the date t. A negative minSoc or maxSoc means that the value wasn't
+// specified and the value is taken from the schedule; if the schedule doesn't specify
+// a minimum, the minimum is 20% above the inverter's low battery capacity. An error
+// is returned if the bounds are inconsistent with each other or if the minimum is
+// below the inverter's low battery capacity.
+func SocBounds(minSoc int, maxSoc int, schedule config.Schedule, lowBatteryCap int, t time.Time) (int, int, error) {
+	p, ok := schedule.Find(t)
+	if minSoc < 0 {
+		minSoc = lowBatteryCap + 20
+		if ok && p.MinSoc > 0 {
+			minSoc = p.MinSoc
 		}
-		break
 	}
-
-	var maxSoc int
-L:
-	for {
-		select {
-		case <-ctx.Done():
-			break L
-		case s := <-ch:
-			if s.Soc > maxSoc {
-				maxSoc = s.Soc
-			}
-			if maxSoc >= 100 {
-				break L
-			}
+	if maxSoc < 0 {
+		maxSoc = 100
+		if ok {
+			maxSoc = p.Max()
 		}
 	}
+	if minSoc < lowBatteryCap {
+		return 0, 0, fmt.Errorf("minimum battery SoC (%d%%) is below the inverter's low battery capacity (%d%%)", minSoc, lowBatteryCap)
+	}
+	if minSoc > maxSoc {
+		return 0, 0, fmt.Errorf("minimum battery SoC (%d%%) is greater than the maximum battery SoC (%d%%)", minSoc, maxSoc)
+	}
+	return minSoc, maxSoc, nil
+}
 
-	if maxSoc == 100 {
+// nextThreshold calculates the battery discharge threshold for the next day given
+// the current threshold and the peak SoC that the battery reached. The threshold
+// is lowered if the battery was fully charged and raised otherwise. The threshold
+// is kept between minSoc and maxSoc.
+func nextThreshold(threshold int, peakSoc int, minSoc int, maxSoc int, deltaSoc int) int {
+	if peakSoc == 100 {
 		newThreshold := 9 * threshold / 10
 		if threshold-newThreshold > deltaSoc {
 			newThreshold = threshold - deltaSoc
 		}
 		threshold = newThreshold
 	} else {
-		r := math.Pow(100.0/float64(maxSoc), 0.5)
+		r := math.Pow(100.0/float64(peakSoc), 0.5)
 		newThreshold := int(r * float64(threshold))
 		if newThreshold-threshold < 1 {
 			newThreshold = threshold + 1
@@ -102,17 +85,118 @@ L:
 	if threshold < minSoc {
 		threshold = minSoc
 	}
+	if threshold > maxSoc {
+		threshold = maxSoc
+	}
 	if threshold > 100 {
 		threshold = 100
 	}
+	return threshold
+}
+
+// socManager decides the battery's discharge threshold for the next day from the
+// peak SoC that the battery reaches during a run.
+type socManager struct {
+	u         *Unit
+	minSoc    int
+	maxSoc    int
+	deltaSoc  int
+	started   bool
+	threshold int
+	peakSoc   int
+}
+
+func newSocManager(u *Unit, minSoc int, maxSoc int, deltaSoc int) *socManager {
+	return &socManager{u: u, minSoc: minSoc, maxSoc: maxSoc, deltaSoc: deltaSoc}
+}
+
+// handle updates the manager with a state and returns true once the battery is fully
+// charged, when the next day's threshold can be decided. The threshold at the start
+// of the run is read when the first state is handled.
+func (m *socManager) handle(ctx context.Context, s api.State) bool {
+	u := m.u
+	if !m.started {
+		threshold, err := u.Inverter.BatteryDischargeThreshold(ctx)
+		if err != nil {
+			u.logger.Println("Failed to read discharge threshold: ", err)
+			return false
+		}
+		m.threshold = threshold
+		m.started = true
+		u.logger.Printf("Minimum allowed battery SOC threshold = %d%%\n", m.minSoc)
+		u.logger.Printf("Maximum allowed battery SOC threshold = %d%%\n", m.maxSoc)
+		u.logger.Printf("Maximum change to battery SOC threshold = %d%%\n", m.deltaSoc)
+		return false
+	}
+	m.peakSoc = max(m.peakSoc, s.Soc)
+	return m.peakSoc >= 100
+}
+
+// finish sets the battery's discharge threshold for the next day unless the threshold
+// was changed manually during the run.
+func (m *socManager) finish(ctx context.Context) {
+	if !m.started {
+		return
+	}
+	u := m.u
 
-	log.Printf("Setting battery's minimum SOC to %d%%\n", threshold)
-	for i := 0; i < 120; i++ {
-		if err = api.UpdateBatteryCapacity(threshold); err == nil {
-			return
+	// The unit's grid state records outages even when the handler misses states.
+	outage := u.grid.occurred()
+	oldThreshold := m.threshold
+	threshold := nextThreshold(oldThreshold, m.peakSoc, m.minSoc, m.maxSoc, m.deltaSoc)
+	if outage && threshold < oldThreshold {
+		u.logger.Println("The grid was down today; not lowering the battery's minimum SOC")
+		threshold = oldThreshold
+	}
+
+	// Don't overwrite a change that was made manually while gnomon was running. The
+	// run's deadline may have passed so the read is bounded separately.
+	readCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	current, err := u.Inverter.BatteryDischargeThreshold(readCtx)
+	cancel()
+	if err != nil {
+		u.logger.Println("Failed to read discharge threshold: ", err)
+	} else if current != oldThreshold {
+		u.logger.Printf("Not changing the battery's minimum SOC since it was changed manually from %d%% to %d%%\n", oldThreshold, current)
+		return
+	}
+	if u.overrides.active(api.BatteryCapacitySetting) {
+		u.logger.Println("Not changing the battery's minimum SOC since it was changed manually")
+		return
+	}
+
+	u.logger.Printf("Setting battery's minimum SOC to %d%%\n", threshold)
+	reason := fmt.Sprintf("soc: peak SOC %d%%, previous threshold %d%%, bounds %d%%-%d%%, max change %d%%", m.peakSoc, oldThreshold, m.minSoc, m.maxSoc, m.deltaSoc)
+	if outage {
+		reason += ", grid outage"
+	}
+	o := u.writeBatteryCapacity(ctx, thresholdPolicy, threshold, reason)
+	u.logger.Println(o)
+	if o.Verified {
+		u.notify(notify.ThresholdChanged, "Battery's minimum SOC changed from %d%% to %d%% (peak SOC was %d%%)", oldThreshold, threshold, m.peakSoc)
+		return
+	}
+	u.notify(notify.GaveUp, "Couldn't set the battery's minimum SOC to %d%% after %d attempts: %s", threshold, o.Attempts, o.Err)
+}
+
+// SocHandler watches the battery's SoC and determines how to adjust the depth of
+// discharge of the battery. The depth of discharge is kept between minSoc and maxSoc.
+func SocHandler(ctx context.Context, u *Unit, wg *sync.WaitGroup, minSoc int, maxSoc int, deltaSoc int, ch chan api.State) {
+	u.logger.Println("Starting management of the battery SOC")
+	defer wg.Done()
+	defer u.logger.Println("Finished management of the battery SOC")
+
+	m := newSocManager(u, minSoc, maxSoc, deltaSoc)
+L:
+	for {
+		select {
+		case <-ctx.Done():
+			break L
+		case s := <-ch:
+			if m.handle(ctx, s) {
+				break L
+			}
 		}
-		log.Println("Updating battery capacity failed: ", err)
-		time.Sleep(60 * time.Second)
 	}
-	log.Println("Couldn't update battery capacity after 120 attempts, giving up")
+	m.finish(ctx)
 }
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestNextThreshold(t *testing.T) {
+	// A fully charged battery lowers the threshold by 10% but by no more than deltaSoc.
+	expected := 45
+	actual := nextThreshold(50, 100, 30, 100, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+
+	expected = 36
+	actual = nextThreshold(40, 100, 30, 100, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+
+	// The threshold can't go below the minimum SoC.
+	expected = 38
+	actual = nextThreshold(40, 100, 38, 100, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+
+	// A battery that isn't fully charged raises the threshold by no more than half of deltaSoc.
+	expected = 43
+	actual = nextThreshold(40, 50, 30, 100, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+
+	expected = 41
+	actual = nextThreshold(40, 99, 30, 100, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+
+	// The threshold can't go above the maximum SoC.
+	expected = 42
+	actual = nextThreshold(40, 50, 30, 42, 5)
+	if actual != expected {
+		t.Errorf("expected %d, got %d", expected, actual)
+	}
+}
+
+func TestSocBounds(t *testing.T) {
+	schedule := config.Schedule{{Months: []int{12}, MinSoc: 30, MaxSoc: 60}}
+	june := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	december := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	minSoc, maxSoc, err := SocBounds(-1, -1, schedule, 20, june)
+	if err != nil || minSoc != 40 || maxSoc != 100 {
+		t.Errorf("expected 40%%-100%%, got %d%%-%d%% (%v)", minSoc, maxSoc, err)
+	}
+
+	minSoc, maxSoc, err = SocBounds(-1, -1, schedule, 20, december)
+	if err != nil || minSoc != 30 || maxSoc != 60 {
+		t.Errorf("expected 30%%-60%%, got %d%%-%d%% (%v)", minSoc, maxSoc, err)
+	}
+
+	minSoc, maxSoc, err = SocBounds(35, 80, schedule, 20, december)
+	if err != nil || minSoc != 35 || maxSoc != 80 {
+		t.Errorf("expected 35%%-80%%, got %d%%-%d%% (%v)", minSoc, maxSoc, err)
+	}
+
+	if _, _, err = SocBounds(15, -1, schedule, 20, june); err == nil {
+		t.Error("expected an error for a minimum below the low battery capacity")
+	}
+
+	if _, _, err = SocBounds(-1, 30, schedule, 20, june); err == nil {
+		t.Error("expected an error for a minimum above the maximum")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// Status is a snapshot of an inverter's state and settings.
+type Status struct {
+	Inverter                  string    `json:"inverter,omitempty"`
+	State                     api.State `json:"state"`
+	BatteryDischargeThreshold int       `json:"battery_discharge_threshold"`
+	LowBatteryCapacity        int       `json:"low_battery_capacity"`
+	EssentialOnly             bool      `json:"essential_only"`
+	RatedPower                int       `json:"rated_power"`
+}
+
+// readStatus authenticates and reads the unit's state and settings.
+func readStatus(ctx context.Context, u *Unit) (Status, error) {
+	var s Status
+	var err error
+	if err = u.Inverter.Authenticate(ctx); err != nil {
+		return s, err
+	}
+	s.Inverter = u.Inverter.SN()
+	if _, err = u.Inverter.ReadState(ctx, &s.State); err != nil {
+		return s, err
+	}
+	if s.BatteryDischargeThreshold, err = u.Inverter.BatteryDischargeThreshold(ctx); err != nil {
+		return s, err
+	}
+	if s.LowBatteryCapacity, err = u.Inverter.LowBatteryCapacity(ctx); err != nil {
+		return s, err
+	}
+	s.EssentialOnly = u.Inverter.EssentialOnly(ctx)
+	if err = ctx.Err(); err != nil {
+		return s, err
+	}
+	s.RatedPower, err = u.Inverter.InverterRatedPower(ctx)
+	return s, err
+}
+
+// ReadStatus reads the state and settings of each of the inverters in the same way
+// as ManageInverter but without starting any handlers or changing any settings.
+// Only the ConfigFile, Location, Inverter, Modbus and Inverters options are used.
+// The statuses that were read are returned along with any errors.
+func ReadStatus(ctx context.Context, opts Options) ([]Status, error) {
+	api.SetLocation(opts.Location)
+	api.SetConfigFile(opts.ConfigFile)
+	units, err := newUnits(opts)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []Status{}
+	errs := []error{}
+	for _, u := range units {
+		s, err := readStatus(ctx, u)
+		if err != nil && u.sn != "" {
+			err = fmt.Errorf("inverter %s: %w", u.sn, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/modbus"
+)
+
+func TestReadStatus(t *testing.T) {
+	sim := modbus.NewSimulator()
+	sim.Set(184, 77)
+	// The registers that hold the settings: the load limit (244) and the capacities
+	// of the six time-of-use programs (268-273). The capacities differ so that
+	// rewriting them with one value would be noticed.
+	sim.Set(268, 35, 36, 37, 38, 39, 40)
+	settings := []uint16{244, 268, 269, 270, 271, 272, 273}
+	before := map[uint16]uint16{}
+	for _, r := range settings {
+		before[r] = sim.Get(r)
+	}
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go sim.Serve(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := Options{Inverter: "2102190001", Modbus: config.Modbus{URL: "tcp://" + l.Addr().String()}}
+	statuses, err := ReadStatus(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(statuses))
+	}
+	s := statuses[0]
+	if s.Inverter != "2102190001" {
+		t.Errorf("expected %q, got %q", "2102190001", s.Inverter)
+	}
+	if s.State.Soc != 77 {
+		t.Errorf("expected %d, got %d", 77, s.State.Soc)
+	}
+	if !s.EssentialOnly {
+		t.Error("expected the inverter to power only the essential loads")
+	}
+	for _, r := range settings {
+		if v := sim.Get(r); v != before[r] {
+			t.Errorf("expected register %d to be unchanged at %d, got %d", r, before[r], v)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/audit"
+	"github.com/hammingweight/gnomon/config"
+	"github.com/hammingweight/gnomon/journal"
+	"github.com/hammingweight/gnomon/modbus"
+	"github.com/hammingweight/gnomon/notify"
+)
+
+// Inverter is an inverter that the handlers manage. It is implemented by api.Inverter
+// and by the simulated inverter that is used for backtesting.
+type Inverter interface {
+	SN() string
+	Authenticate(ctx context.Context) error
+	ReadState(ctx context.Context, s *api.State) (bool, error)
+	Poll(ctx context.Context, staleLimit time.Duration, ch chan api.State)
+	InverterRatedPower(ctx context.Context) (int, error)
+	BatteryDischargeThreshold(ctx context.Context) (int, error)
+	LowBatteryCapacity(ctx context.Context) (int, error)
+	EssentialOnly(ctx context.Context) bool
+	UpdateBatteryCapacity(capacity int) error
+	UpdateEssentialOnly(eo bool) error
+	ObserveSettings(f func(api.SettingEvent)) func()
+	SetJournal(f *journal.File)
+}
+
+// clock tells the handlers the time. The handlers use the real time when managing an
+// inverter and the time of the recorded states when backtesting.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Unit is an inverter managed by gnomon along with the state shared by its handlers.
+type Unit struct {
+	// Inverter communicates with the inverter.
+	Inverter Inverter
+	sn       string
+	// several is true if the unit is one of several configured inverters so that
+	// each has its own files.
+	several   bool
+	logger    *log.Logger
+	overrides *overrideTracker
+	grid      *gridState
+	group     *ctGroup
+	clock     clock
+	// recordChange records an attempt to change a setting in the audit log.
+	recordChange func(audit.Entry) error
+}
+
+// NewUnit returns a unit for the inverter with the serial number sn; the synkctl
+// config's default inverter is used if sn is empty. The inverter is accessed over
+// Modbus if m has a URL. Log messages and notifications about the inverter are
+// prefixed with its serial number.
+func NewUnit(sn string, m config.Modbus) (*Unit, error) {
+	return newUnit(sn, m, map[string]*modbus.Client{})
+}
+
+// newUnit returns a unit like NewUnit. Units whose inverters have the same Modbus
+// URL, e.g. inverters on one RS485 bus, share a connection so that their requests
+// don't collide; clients holds the client of each URL.
+func newUnit(sn string, m config.Modbus, clients map[string]*modbus.Client) (*Unit, error) {
+	inv := api.NewInverter(sn)
+	if m.URL != "" {
+		client, ok := clients[m.URL]
+		if ok {
+			client = client.ForSlave(m.SlaveID)
+		} else {
+			var err error
+			if client, err = modbus.New(m); err != nil {
+				return nil, err
+			}
+			clients[m.URL] = client
+		}
+		inv.SetBackend(modbus.NewInverter(client))
+	}
+	u := &Unit{
+		Inverter:     inv,
+		sn:           sn,
+		logger:       log.Default(),
+		overrides:    newOverrideTracker(0),
+		grid:         &gridState{},
+		clock:        realClock{},
+		recordChange: audit.Record,
+	}
+	if sn != "" {
+		u.logger = log.New(log.Writer(), "["+sn+"] ", log.Flags()|log.Lmsgprefix)
+	}
+	return u, nil
+}
+
+// notify sends a notification that names the unit's inverter.
+func (u *Unit) notify(event string, format string, args ...any) {
+	if u.sn != "" {
+		format = "Inverter " + u.sn + ": " + format
+	}
+	notify.Notify(event, format, args...)
+}
+
+// path returns the path of the unit's own copy of a file, e.g. a journal. If several
+// inverters are configured, the inverter's serial number is added before the file's
+// extension; otherwise the path is unchanged.
+func (u *Unit) path(path string) string {
+	if !u.several || path == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + u.sn + ext
+}
+
+// ctGroup is a parallel stack of inverters whose CT coils are switched together.
+// The first unit in the group decides whether the group powers all loads using
+// the group's combined power and its lowest SoC.
+type ctGroup struct {
+	mutex  sync.Mutex
+	units  []*Unit
+	states map[*Unit]api.State
+}
+
+// newCtGroup groups the units so that their CT coils are switched together.
+func newCtGroup(units []*Unit) *ctGroup {
+	g := &ctGroup{units: units, states: map[*Unit]api.State{}}
+	for _, u := range units {
+		u.group = g
+	}
+	return g
+}
+
+// leader returns true if u makes the CT coil decisions for its group. A unit
+// that isn't in a group makes its own decisions.
+func (u *Unit) leader() bool {
+	return u.group == nil || u.group.units[0] == u
+}
+
+// update records the latest state of a unit in the group.
+func (g *ctGroup) update(u *Unit, s api.State) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.states[u] = s
+}
+
+// combine returns the state s with the power summed over the group and the lowest
+// SoC in the group. States of other units that are more than 20 minutes older or
+// newer than s are ignored.
+func (g *ctGroup) combine(u *Unit, s api.State) api.State {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, m := range g.units {
+		other, ok := g.states[m]
+		if m == u || !ok || other.Time.Sub(s.Time).Abs() > 20*time.Minute {
+			continue
+		}
+		s.Power += other.Power
+		s.Soc = min(s.Soc, other.Soc)
+	}
+	return s
+}
+
+// members returns the units whose CT coils are switched along with u's.
+func (u *Unit) members() []*Unit {
+	if u.group == nil {
+		return []*Unit{u}
+	}
+	return u.group.units
+}
+
+// ratedPower returns the combined rated power of the units whose CT coils are
+// switched along with u's.
+func (u *Unit) ratedPower(ctx context.Context) (int, error) {
+	total := 0
+	for _, m := range u.members() {
+		power, err := m.Inverter.InverterRatedPower(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += power
+	}
+	return total, nil
+}
+
+// coilOverridden returns true if the CT coil of any unit in u's group was changed
+// manually.
+func (u *Unit) coilOverridden() bool {
+	for _, m := range u.members() {
+		if m.overrides.active(api.EssentialOnlySetting) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCoil sets whether u, and the other units in its group, power only the
+// essential loads. The outcome of u's write is returned unless a write to another
+// unit in the group failed.
+func (u *Unit) writeCoil(ctx context.Context, p Policy, eo bool, reason string) Outcome {
+	var outcome Outcome
+	for _, m := range u.members() {
+		o := m.writeEssentialOnly(ctx, p, eo, reason)
+		m.logger.Println(o)
+		if m == u || !o.Verified {
+			if outcome.Setting == "" || outcome.Verified {
+				outcome = o
+			}
+		}
+	}
+	return outcome
+}
+
+// GroupHandler passes the states of an inverter in a CT group to the unit that
+// decides when the group powers all loads.
+func GroupHandler(ctx context.Context, u *Unit, ch chan api.State) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-ch:
+			u.group.update(u, s)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestCtGroup(t *testing.T) {
+	units := []*Unit{}
+	for _, sn := range []string{"1", "2", "3"} {
+		u, err := NewUnit(sn, config.Modbus{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, u)
+	}
+	g := newCtGroup(units)
+	if !units[0].leader() || units[1].leader() {
+		t.Error("expected the first unit to lead the group")
+	}
+
+	now := time.Now()
+	g.update(units[1], api.State{Time: now, Power: 2000, Soc: 60})
+	g.update(units[2], api.State{Time: now.Add(-time.Hour), Power: 3000, Soc: 10})
+	s := g.combine(units[0], api.State{Time: now, Power: 1000, Soc: 80})
+	if s.Power != 3000 {
+		t.Errorf("expected %d, got %d", 3000, s.Power)
+	}
+	if s.Soc != 60 {
+		t.Errorf("expected %d, got %d", 60, s.Soc)
+	}
+
+	// Only the files of one of several inverters have the serial number in their paths.
+	if p := units[0].path("/var/gnomon/gnomon.journal"); p != "/var/gnomon/gnomon.journal" {
+		t.Errorf("unexpected journal path %s", p)
+	}
+	units[0].several = true
+	if p := units[0].path("/var/gnomon/gnomon.journal"); p != "/var/gnomon/gnomon.1.journal" {
+		t.Errorf("unexpected journal path %s", p)
+	}
+}
+
+func TestNewUnits(t *testing.T) {
+	opts := Options{Inverter: "2", Inverters: config.Inverters{{SN: "1", CtGroup: "stack"}, {SN: "2", CtGroup: "stack"}}}
+	units, err := newUnits(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].sn != "2" {
+		t.Fatalf("expected only inverter 2 to be managed, got %d units", len(units))
+	}
+	if units[0].group != nil {
+		t.Error("expected no CT group with one managed inverter")
+	}
+	if p := units[0].path("gnomon.journal"); p != "gnomon.2.journal" {
+		t.Errorf("unexpected journal path %s", p)
+	}
+
+	// A single inverter keeps the usual paths even if its serial number is given.
+	units, err = newUnits(Options{Inverter: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := units[0].path("gnomon.journal"); p != "gnomon.journal" {
+		t.Errorf("unexpected journal path %s", p)
+	}
+}
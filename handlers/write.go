@@ -0,0 +1,162 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/audit"
+)
+
+// Policy specifies how often a setting is written before giving up.
+type Policy struct {
+	// Attempts is the maximum number of times that the setting is written.
+	Attempts int
+	// Interval is the time to wait after a failed attempt.
+	Interval time.Duration
+	// Grace is how long attempts may continue after the context is done, e.g.
+	// to restore a setting when the run ends. It should be no more than a few
+	// minutes so that gnomon stops soon after the end of the run.
+	Grace time.Duration
+}
+
+var (
+	// coilPolicy is used to switch the CT coil while managing the inverter. The
+	// attempts span the time that the SunSynk API takes to report a change.
+	coilPolicy = Policy{Attempts: 10, Interval: 30 * time.Second}
+	// coilCleanupPolicy is used to power only the essential loads at the end of a run.
+	coilCleanupPolicy = Policy{Attempts: 10, Interval: 30 * time.Second, Grace: 5 * time.Minute}
+	// thresholdPolicy is used to set the battery's discharge threshold at the end of a run.
+	thresholdPolicy = Policy{Attempts: 120, Interval: time.Minute, Grace: 5 * time.Minute}
+	// restorePolicy is used to restore settings from the journal.
+	restorePolicy = Policy{Attempts: 3, Interval: 30 * time.Second}
+)
+
+// Outcome describes the result of writing a setting.
+type Outcome struct {
+	Setting  string
+	Value    any
+	Attempts int
+	Verified bool
+	Err      error
+}
+
+func (o Outcome) String() string {
+	if o.Verified {
+		return fmt.Sprintf("%s set to %v after %d attempt(s)", o.Setting, o.Value, o.Attempts)
+	}
+	return fmt.Sprintf("failed to set %s to %v after %d attempt(s): %v", o.Setting, o.Value, o.Attempts, o.Err)
+}
+
+// withGrace returns a context that expires the grace period after ctx's deadline,
+// or after now if ctx is already done or has no deadline.
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now()
+	if d, ok := ctx.Deadline(); ok && d.After(deadline) {
+		deadline = d
+	}
+	return context.WithDeadline(context.WithoutCancel(ctx), deadline.Add(grace))
+}
+
+// writeSetting writes a value using the write function, retrying as specified by the
+// policy until the write is accepted, and then reads the setting back until it has
+// the value. No further
+// attempts are made once the context (extended by the policy's grace period) is done.
+// The outcome is recorded in the audit log along with the reason for the change.
+func writeSetting[T comparable](ctx context.Context, u *Unit, p Policy, setting string, value T, reason string, write func(T) error, read func(context.Context) (T, error)) (o Outcome) {
+	if p.Grace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withGrace(ctx, p.Grace)
+		defer cancel()
+	}
+
+	// The old value is the one last seen by the override tracker so that the
+	// write doesn't cost another request.
+	e := audit.Entry{Time: u.clock.Now(), Inverter: u.sn, Setting: setting, NewValue: value, Reason: reason}
+	if old, ok := u.overrides.last(setting); ok {
+		e.OldValue = old
+	}
+	defer func() {
+		e.Attempts = o.Attempts
+		e.Verified = o.Verified
+		if o.Err != nil {
+			e.Error = o.Err.Error()
+		}
+		if err := u.recordChange(e); err != nil {
+			u.logger.Println("Failed to update audit log: ", err)
+		}
+	}()
+
+	o = Outcome{Setting: setting, Value: value}
+	written := false
+	for o.Attempts < p.Attempts {
+		if ctx.Err() != nil {
+			o.Err = ctx.Err()
+			return o
+		}
+		o.Attempts++
+		// Once the inverter has accepted the value, it is polled until it reports the
+		// value rather than being written again.
+		if !written {
+			o.Err = write(value)
+			written = o.Err == nil || errors.Is(o.Err, api.ErrNotVerified)
+		}
+		if written {
+			v, err := read(ctx)
+			if err == nil && v == value {
+				o.Verified = true
+				o.Err = nil
+				return o
+			}
+			o.Err = api.ErrNotVerified
+			if err != nil {
+				o.Err = err
+			}
+		}
+		u.logger.Printf("Attempt %d to set %s to %v failed: %v\n", o.Attempts, setting, value, o.Err)
+		if o.Attempts == p.Attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			o.Err = ctx.Err()
+			return o
+		case <-time.After(p.Interval):
+		}
+	}
+	return o
+}
+
+// readEssentialOnly adapts Inverter.EssentialOnly for use with writeSetting.
+func (u *Unit) readEssentialOnly(ctx context.Context) (bool, error) {
+	eo := u.Inverter.EssentialOnly(ctx)
+	return eo, ctx.Err()
+}
+
+// writeEssentialOnly sets whether the inverter powers only the essential loads.
+func (u *Unit) writeEssentialOnly(ctx context.Context, p Policy, eo bool, reason string) Outcome {
+	return writeSetting(ctx, u, p, api.EssentialOnlySetting, eo, reason, u.Inverter.UpdateEssentialOnly, u.readEssentialOnly)
+}
+
+// writeBatteryCapacity sets the battery's discharge threshold.
+func (u *Unit) writeBatteryCapacity(ctx context.Context, p Policy, capacity int, reason string) Outcome {
+	return writeSetting(ctx, u, p, api.BatteryCapacitySetting, capacity, reason, u.Inverter.UpdateBatteryCapacity, u.Inverter.BatteryDischargeThreshold)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestWriteSetting(t *testing.T) {
+	u, err := NewUnit("", config.Modbus{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{Attempts: 3, Interval: time.Millisecond}
+	value := 0
+	writes := 0
+	write := func(v int) error {
+		writes++
+		if writes < 2 {
+			return errors.New("write failed")
+		}
+		value = v
+		return nil
+	}
+	read := func(context.Context) (int, error) {
+		return value, nil
+	}
+
+	o := writeSetting(context.Background(), u, p, api.BatteryCapacitySetting, 40, "test", write, read)
+	if !o.Verified || o.Err != nil {
+		t.Errorf("expected the write to be verified, got %s", o)
+	}
+	if o.Attempts != 2 {
+		t.Errorf("expected %d attempts, got %d", 2, o.Attempts)
+	}
+
+	// An accepted write is polled, not rewritten, and gives up after the policy's attempts.
+	writes = 0
+	o = writeSetting(context.Background(), u, p, api.BatteryCapacitySetting, 50, "test", func(int) error { writes++; return nil }, read)
+	if o.Verified || !errors.Is(o.Err, api.ErrNotVerified) {
+		t.Errorf("expected the write not to be verified, got %s", o)
+	}
+	if writes != 1 {
+		t.Errorf("expected %d writes, got %d", 1, writes)
+	}
+	if o.Attempts != 3 {
+		t.Errorf("expected %d attempts, got %d", 3, o.Attempts)
+	}
+}
+
+func TestWriteSettingDeadline(t *testing.T) {
+	u, err := NewUnit("", config.Modbus{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{Attempts: 10, Interval: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	o := writeSetting(ctx, u, p, api.EssentialOnlySetting, true, "test", func(bool) error { return errors.New("write failed") }, func(context.Context) (bool, error) { return false, nil })
+	if !errors.Is(o.Err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", o.Err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the write to stop at the deadline, took %s", time.Since(start))
+	}
+
+	// With a grace period, a write can be made after the deadline.
+	p = Policy{Attempts: 1, Grace: time.Minute}
+	o = writeSetting(ctx, u, p, api.BatteryCapacitySetting, 30, "test", func(int) error { return nil }, func(context.Context) (int, error) { return 30, nil })
+	if !o.Verified {
+		t.Errorf("expected the write to be verified, got %s", o)
+	}
+}
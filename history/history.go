@@ -0,0 +1,146 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history stores a summary of every gnomon run in a file with one
+// JSON object per line.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Energy holds energy totals in watt-hours.
+type Energy struct {
+	PV               float64 `json:"pv_wh"`
+	Load             float64 `json:"load_wh"`
+	GridImport       float64 `json:"grid_import_wh"`
+	GridExport       float64 `json:"grid_export_wh"`
+	BatteryCharge    float64 `json:"battery_charge_wh"`
+	BatteryDischarge float64 `json:"battery_discharge_wh"`
+}
+
+// Add returns the sum of two energy totals.
+func (e Energy) Add(o Energy) Energy {
+	return Energy{
+		PV:               e.PV + o.PV,
+		Load:             e.Load + o.Load,
+		GridImport:       e.GridImport + o.GridImport,
+		GridExport:       e.GridExport + o.GridExport,
+		BatteryCharge:    e.BatteryCharge + o.BatteryCharge,
+		BatteryDischarge: e.BatteryDischarge + o.BatteryDischarge,
+	}
+}
+
+func (e Energy) String() string {
+	return fmt.Sprintf("PV = %.0fWh, Load = %.0fWh, Grid import = %.0fWh, Grid export = %.0fWh, Battery charge = %.0fWh, Battery discharge = %.0fWh",
+		e.PV, e.Load, e.GridImport, e.GridExport, e.BatteryCharge, e.BatteryDischarge)
+}
+
+// Outage is a period when the grid was down.
+type Outage struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds float64   `json:"seconds"`
+}
+
+// Day summarizes what happened on one day of a run.
+type Day struct {
+	Date   string `json:"date"`
+	MinSoc int    `json:"min_soc"`
+	MaxSoc int    `json:"max_soc"`
+	// CtOnSeconds is how long the inverter powered all loads.
+	CtOnSeconds float64 `json:"ct_on_seconds"`
+	// Switches is the number of times the inverter switched between powering
+	// all loads and powering only the essential loads.
+	Switches int `json:"switches"`
+	// Energy is the total energy for the day.
+	Energy Energy `json:"energy"`
+	// EssentialOnly is the energy while the inverter powered only the essential loads.
+	EssentialOnly Energy `json:"essential_only"`
+	// AllLoads is the energy while the inverter powered all loads.
+	AllLoads Energy `json:"all_loads"`
+	// Outages are the grid outages that started on the day.
+	Outages []Outage `json:"outages,omitempty"`
+}
+
+// UnknownThreshold is recorded as a run's discharge threshold if it couldn't be read.
+const UnknownThreshold = -1
+
+// Run summarizes a gnomon run.
+type Run struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Inverter is the serial number of the inverter if gnomon managed several.
+	Inverter string `json:"inverter,omitempty"`
+	// StartThreshold and EndThreshold are the battery discharge thresholds
+	// at the start and end of the run. EndThreshold is UnknownThreshold if the
+	// threshold couldn't be read when the run finished.
+	StartThreshold int   `json:"start_threshold"`
+	EndThreshold   int   `json:"end_threshold"`
+	Days           []Day `json:"days"`
+}
+
+// Append adds a run to the history file at path.
+func Append(path string, r Run) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Read returns all runs in the history file at path. An empty slice is
+// returned if the file doesn't exist.
+func Read(path string) ([]Run, error) {
+	runs := []Run{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Run
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, scanner.Err()
+}
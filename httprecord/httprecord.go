@@ -0,0 +1,280 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package httprecord records the requests that gnomon makes to the SunSynk API,
+// and the responses, so that they can be attached to a bug report and served
+// back to reproduce the problem. Credentials and tokens are redacted before an
+// exchange is written.
+package httprecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces credentials and tokens in recorded exchanges.
+const Redacted = "REDACTED"
+
+// sensitive are the (lower case) names of headers, query parameters and JSON
+// fields that are redacted.
+var sensitive = []string{"authorization", "cookie", "set-cookie", "username", "password", "email", "access_token", "refresh_token", "token", "client_secret"}
+
+func isSensitive(name string) bool {
+	return slices.Contains(sensitive, strings.ToLower(name))
+}
+
+// Exchange is a recorded request and its response.
+type Exchange struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	ResponseBody    string      `json:"response_body"`
+}
+
+// key identifies the requests that an exchange can be replayed for.
+func (e Exchange) key() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return e.Method + " " + e.URL
+	}
+	return e.Method + " " + u.Path
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for k := range h {
+		if isSensitive(k) {
+			h[k] = []string{Redacted}
+		}
+	}
+	return h
+}
+
+func redactURL(u *url.URL) string {
+	r := *u
+	r.User = nil
+	q := r.Query()
+	for k := range q {
+		if isSensitive(k) {
+			q.Set(k, Redacted)
+		}
+	}
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+// redactValue redacts sensitive fields in a decoded JSON value and returns true
+// if any were found.
+func redactValue(v any) bool {
+	redacted := false
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if isSensitive(k) {
+				v[k] = Redacted
+				redacted = true
+			} else if redactValue(e) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if redactValue(e) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// redactBody redacts sensitive fields of a JSON or form encoded body; other
+// bodies, and bodies without sensitive fields, are kept as they are.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err == nil {
+		if !redactValue(v) {
+			return string(body)
+		}
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil {
+		redacted := false
+		for k := range form {
+			if isSensitive(k) {
+				form.Set(k, Redacted)
+				redacted = true
+			}
+		}
+		if redacted {
+			return form.Encode()
+		}
+	}
+	return string(body)
+}
+
+// Recorder is an http.RoundTripper that writes every exchange to a directory.
+type Recorder struct {
+	mutex sync.Mutex
+	dir   string
+	next  http.RoundTripper
+	seq   int
+}
+
+// NewRecorder returns a recorder that sends requests using next and writes the
+// exchanges to dir.
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Recorder{dir: dir, next: next}, nil
+}
+
+// RoundTrip sends the request and records the exchange. A failure to record the
+// exchange is logged rather than failing the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	e := Exchange{
+		Method:          req.Method,
+		URL:             redactURL(req.URL),
+		RequestHeaders:  redactHeaders(req.Header),
+		RequestBody:     redactBody(reqBody),
+		Status:          resp.StatusCode,
+		ResponseHeaders: redactHeaders(resp.Header),
+		ResponseBody:    redactBody(respBody),
+	}
+	if err = r.write(e); err != nil {
+		log.Println("Failed to record HTTP exchange: ", err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) write(e Exchange) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seq++
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, fmt.Sprintf("%06d.json", r.seq)), data, 0600)
+}
+
+// Replayer is an http.RoundTripper that serves recorded exchanges. Requests are
+// matched to exchanges by method and path; the exchanges for a request are served
+// in the order that they were recorded and the last one is repeated once they are
+// exhausted.
+type Replayer struct {
+	mutex     sync.Mutex
+	exchanges map[string][]Exchange
+	served    map[string]int
+}
+
+// NewReplayer reads the exchanges recorded in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded exchanges in %s", dir)
+	}
+	slices.Sort(files)
+	r := &Replayer{exchanges: map[string][]Exchange{}, served: map[string]int{}}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var e Exchange
+		if err = json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		r.exchanges[e.key()] = append(r.exchanges[e.key()], e)
+	}
+	return r, nil
+}
+
+// RoundTrip returns the next recorded response to the request.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.Path
+	r.mutex.Lock()
+	exchanges := r.exchanges[key]
+	if len(exchanges) == 0 {
+		r.mutex.Unlock()
+		return nil, errors.New("no recorded response for " + key)
+	}
+	i := min(r.served[key], len(exchanges)-1)
+	r.served[key]++
+	r.mutex.Unlock()
+
+	e := exchanges[i]
+	header := e.ResponseHeaders.Clone()
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(e.ResponseBody)),
+		ContentLength: int64(len(e.ResponseBody)),
+		Request:       req,
+	}, nil
+}
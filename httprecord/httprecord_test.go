@@ -0,0 +1,97 @@
+package httprecord_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hammingweight/gnomon/fakeserver"
+	"github.com/hammingweight/gnomon/httprecord"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(fakeserver.New("carl@example.com", "VerySecret"))
+	defer srv.Close()
+	dir := t.TempDir()
+	rec, err := httprecord.NewRecorder(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+
+	resp, err := client.Post(srv.URL+"/oauth/token", "application/json", strings.NewReader(`{"username":"carl@example.com","password":"VerySecret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/inverter/"+fakeserver.DefaultSN, nil)
+	req.Header.Set("Authorization", "Bearer fake-token-1")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("expected %d exchanges, got %d", 2, len(files))
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		for _, secret := range []string{"carl@example.com", "VerySecret", "fake-token-1"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("expected %s to be redacted from %s", secret, f)
+			}
+		}
+	}
+
+	rep, err := httprecord.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: rep}
+	for i := 0; i < 2; i++ {
+		resp, err = client.Get("http://replay.invalid/api/v1/inverter/" + fakeserver.DefaultSN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.TrimSpace(string(replayed)) != strings.TrimSpace(string(recorded)) {
+			t.Errorf("expected %s, got %s", recorded, replayed)
+		}
+	}
+	if _, err = client.Get("http://replay.invalid/api/v1/inverters"); err == nil {
+		t.Error("expected an error for a request that wasn't recorded")
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	srv := httptest.NewServer(fakeserver.New("", ""))
+	defer srv.Close()
+	dir := filepath.Join(t.TempDir(), "exchanges")
+	rec, err := httprecord.NewRecorder(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+
+	// A request succeeds even if the exchange can't be recorded.
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Post(srv.URL+"/oauth/token", "application/json", strings.NewReader(`{"username":"carl","password":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package journal keeps an on-disk record of the inverter settings that gnomon
+// found at startup and of every change that gnomon makes. The journal is removed
+// when gnomon exits cleanly so a journal that exists at startup indicates that
+// the previous run did not finish and the inverter may need to be reconciled.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Names of the settings that are recorded in the journal.
+const (
+	BatteryCapacity = "battery_capacity"
+	EssentialOnly   = "essential_only"
+)
+
+// Settings are the inverter settings that gnomon can change.
+type Settings struct {
+	BatteryCapacity int  `json:"battery_capacity"`
+	EssentialOnly   bool `json:"essential_only"`
+}
+
+// Change is a single update that gnomon made to the inverter's settings.
+type Change struct {
+	Time    time.Time `json:"time"`
+	Setting string    `json:"setting"`
+	Value   any       `json:"value"`
+}
+
+// Journal is the persisted record of a gnomon run.
+type Journal struct {
+	Pid      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Original Settings  `json:"original"`
+	Current  Settings  `json:"current"`
+	Changes  []Change  `json:"changes"`
+}
+
+// File is an open journal. A nil *File records nothing.
+type File struct {
+	mutex   sync.Mutex
+	path    string
+	journal *Journal
+}
+
+// Read reads the journal stored at path. The returned journal is nil if
+// there is no journal at path.
+func Read(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	jnl := &Journal{}
+	if err = json.Unmarshal(data, jnl); err != nil {
+		return nil, err
+	}
+	return jnl, nil
+}
+
+func write(path string, jnl *Journal) error {
+	data, err := json.MarshalIndent(jnl, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it so that a crash never leaves a
+	// truncated journal.
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Open starts a new journal at path recording the inverter's original settings.
+func Open(path string, original Settings) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	jnl := &Journal{
+		Pid:      os.Getpid(),
+		Started:  time.Now(),
+		Original: original,
+		Current:  original,
+		Changes:  []Change{},
+	}
+	if err := write(path, jnl); err != nil {
+		return nil, err
+	}
+	return &File{path: path, journal: jnl}, nil
+}
+
+func (f *File) record(setting string, value any, update func(*Settings)) error {
+	if f == nil {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.journal == nil {
+		return nil
+	}
+	update(&f.journal.Current)
+	f.journal.Changes = append(f.journal.Changes, Change{time.Now(), setting, value})
+	return write(f.path, f.journal)
+}
+
+// RecordBatteryCapacity records that gnomon changed the battery capacity. It
+// does nothing if the journal isn't open.
+func (f *File) RecordBatteryCapacity(capacity int) error {
+	return f.record(BatteryCapacity, capacity, func(s *Settings) {
+		s.BatteryCapacity = capacity
+	})
+}
+
+// RecordEssentialOnly records that gnomon changed whether the inverter should
+// power only the essential loads. It does nothing if the journal isn't open.
+func (f *File) RecordEssentialOnly(essentialOnly bool) error {
+	return f.record(EssentialOnly, essentialOnly, func(s *Settings) {
+		s.EssentialOnly = essentialOnly
+	})
+}
+
+// Close removes the journal to mark that gnomon exited cleanly.
+func (f *File) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.journal == nil {
+		return nil
+	}
+	f.journal = nil
+	return Remove(f.path)
+}
+
+// Remove deletes the journal at path, if it exists.
+func Remove(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SafeSettings returns the settings that the inverter should be restored to
+// after an unclean exit: the inverter powers only the essential loads and the
+// battery capacity is the last value that gnomon set (or the original value
+// if gnomon never changed it).
+func (jnl *Journal) SafeSettings() Settings {
+	return Settings{
+		BatteryCapacity: jnl.Current.BatteryCapacity,
+		EssentialOnly:   true,
+	}
+}
@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnomon.journal")
+	f, err := Open(path, Settings{BatteryCapacity: 40, EssentialOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.RecordEssentialOnly(false); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.RecordBatteryCapacity(35); err != nil {
+		t.Fatal(err)
+	}
+
+	jnl, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jnl == nil {
+		t.Fatal("expected a journal")
+	}
+	if len(jnl.Changes) != 2 {
+		t.Errorf("expected 2 changes, got %d", len(jnl.Changes))
+	}
+	if jnl.Original.BatteryCapacity != 40 {
+		t.Errorf("expected original battery capacity 40, got %d", jnl.Original.BatteryCapacity)
+	}
+	safe := jnl.SafeSettings()
+	if safe.BatteryCapacity != 35 {
+		t.Errorf("expected battery capacity 35, got %d", safe.BatteryCapacity)
+	}
+	if !safe.EssentialOnly {
+		t.Error("expected essential only to be true")
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	jnl, err = Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jnl != nil {
+		t.Error("expected the journal to be removed")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// tcpFramer frames PDUs with the Modbus TCP (MBAP) header.
+type tcpFramer struct {
+	transaction uint16
+}
+
+func (f *tcpFramer) send(c conn, slave byte, pdu []byte) ([]byte, error) {
+	f.transaction++
+	req := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], f.transaction)
+	binary.BigEndian.PutUint16(req[4:], uint16(1+len(pdu)))
+	req[6] = slave
+	copy(req[7:], pdu)
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(c, header); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint16(header[4:])
+		if length < 2 || length > 254 {
+			return nil, fmt.Errorf("invalid modbus tcp length %d", length)
+		}
+		resp := make([]byte, length-1)
+		if _, err := io.ReadFull(c, resp); err != nil {
+			return nil, err
+		}
+		// Discard late responses to earlier requests that timed out.
+		if binary.BigEndian.Uint16(header[0:]) == f.transaction {
+			return resp, nil
+		}
+	}
+}
+
+// rtuFramer frames PDUs as Modbus RTU frames with a CRC.
+type rtuFramer struct{}
+
+// crc16 returns the Modbus CRC of data.
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// rtuFrame returns the RTU frame for a PDU; the CRC is sent low byte first.
+func rtuFrame(slave byte, pdu []byte) []byte {
+	frame := append([]byte{slave}, pdu...)
+	return binary.LittleEndian.AppendUint16(frame, crc16(frame))
+}
+
+// rtuResponseLength returns the number of bytes that follow the slave, function
+// and first data byte of a response.
+func rtuResponseLength(function byte, first byte) (int, error) {
+	switch {
+	case function&0x80 != 0:
+		return 2, nil
+	case function == readHoldingRegisters:
+		return int(first) + 2, nil
+	case function == writeMultipleRegisters:
+		return 5, nil
+	}
+	return 0, fmt.Errorf("unexpected modbus function %d in response", function)
+}
+
+func (rtuFramer) send(c conn, slave byte, pdu []byte) ([]byte, error) {
+	if _, err := c.Write(rtuFrame(slave, pdu)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, err
+	}
+	n, err := rtuResponseLength(header[1], header[2])
+	if err != nil {
+		return nil, err
+	}
+	rest := make([]byte, n)
+	if _, err := io.ReadFull(c, rest); err != nil {
+		return nil, err
+	}
+	return rtuPDU(append(header, rest...), slave)
+}
+
+// rtuPDU checks the CRC and slave of an RTU response frame and returns its PDU.
+func rtuPDU(frame []byte, slave byte) ([]byte, error) {
+	if len(frame) < 4 {
+		return nil, errors.New("modbus rtu response is too short")
+	}
+	body := frame[:len(frame)-2]
+	if binary.LittleEndian.Uint16(frame[len(frame)-2:]) != crc16(body) {
+		return nil, errors.New("modbus rtu response has a bad crc")
+	}
+	if body[0] != slave {
+		return nil, fmt.Errorf("modbus rtu response is from slave %d, not %d", body[0], slave)
+	}
+	return body[1:], nil
+}
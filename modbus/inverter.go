@@ -0,0 +1,214 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// Holding registers of SunSynk (and Deye) single phase hybrid inverters.
+const (
+	// regRatedPower is two registers, low word first, in units of 0.1W.
+	regRatedPower = 16
+	// regInverterTemperature is in units of 0.1°C offset by 100°C.
+	regInverterTemperature = 91
+	// regPV1Voltage and regPV2Voltage are in units of 0.1V.
+	regPV1Voltage = 109
+	regPV2Voltage = 111
+	// regGridVoltage is in units of 0.1V.
+	regGridVoltage = 150
+	// regGridPower is signed; positive when importing from the grid.
+	regGridPower = 169
+	regLoadPower = 178
+	// regBatteryTemperature is in units of 0.1°C offset by 100°C.
+	regBatteryTemperature = 182
+	// regBatteryVoltage is in units of 0.01V.
+	regBatteryVoltage = 183
+	regBatterySoc     = 184
+	regPV1Power       = 186
+	regPV2Power       = 187
+	// regBatteryPower is signed; positive when discharging.
+	regBatteryPower       = 190
+	regBatteryLowCapacity = 219
+	regLoadLimit          = 244
+	regProgramCapacity    = 268
+	programs              = 6
+	realtimeStart         = regGridVoltage
+	realtimeCount         = regBatteryPower - realtimeStart + 1
+)
+
+// Values of the load limit register.
+const (
+	allowExport = 0
+	// essentialsOnly limits the inverter to powering the essential loads.
+	essentialsOnly = 1
+	// zeroExport lets the inverter power all loads without exporting to the grid.
+	zeroExport = 2
+)
+
+// Inverter reads and writes a SunSynk inverter's registers over Modbus. It
+// implements api.Backend.
+type Inverter struct {
+	client *Client
+	mutex  sync.Mutex
+	// allLoadsMode is the load limit that is restored when the inverter is allowed
+	// to power all loads.
+	allLoadsMode uint16
+	// limitRead is true once the load limit has been read.
+	limitRead bool
+}
+
+// NewInverter returns an inverter that is accessed using the client.
+func NewInverter(client *Client) *Inverter {
+	return &Inverter{client: client, allLoadsMode: zeroExport}
+}
+
+// setLoadLimit remembers the load limit that was read unless it is essentials only.
+// The caller must hold inv.mutex.
+func (inv *Inverter) setLoadLimit(limit uint16) {
+	inv.limitRead = true
+	if limit != essentialsOnly {
+		inv.allLoadsMode = limit
+	}
+}
+
+// allLoadsLimit returns the load limit that lets the inverter power all loads. The
+// load limit is read before it is first written so that the inverter's own mode is
+// restored; zero export is used if the inverter was powering only the essential loads.
+func (inv *Inverter) allLoadsLimit(ctx context.Context) (uint16, error) {
+	inv.mutex.Lock()
+	read := inv.limitRead
+	inv.mutex.Unlock()
+	if !read {
+		limit, err := inv.client.ReadHoldingRegisters(ctx, regLoadLimit, 1)
+		if err != nil {
+			return 0, err
+		}
+		inv.mutex.Lock()
+		inv.setLoadLimit(limit[0])
+		inv.mutex.Unlock()
+	}
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	return inv.allLoadsMode, nil
+}
+
+func temperature(v uint16) float64 {
+	return float64(int(v)-1000) / 10
+}
+
+// ReadState reads the inverter's current state.
+func (inv *Inverter) ReadState(ctx context.Context) (api.State, error) {
+	var s api.State
+	rt, err := inv.client.ReadHoldingRegisters(ctx, realtimeStart, realtimeCount)
+	if err != nil {
+		return s, err
+	}
+	reg := func(addr int) uint16 {
+		return rt[addr-realtimeStart]
+	}
+	pv, err := inv.client.ReadHoldingRegisters(ctx, regPV1Voltage, regPV2Voltage-regPV1Voltage+1)
+	if err != nil {
+		return s, err
+	}
+	temp, err := inv.client.ReadHoldingRegisters(ctx, regInverterTemperature, 1)
+	if err != nil {
+		return s, err
+	}
+
+	s.PV = []api.MPPT{
+		{Power: int(reg(regPV1Power)), Voltage: float64(pv[0]) / 10},
+		{Power: int(reg(regPV2Power)), Voltage: float64(pv[regPV2Voltage-regPV1Voltage]) / 10},
+	}
+	s.Power = s.PV[0].Power + s.PV[1].Power
+	s.Soc = int(reg(regBatterySoc))
+	s.Load = int(reg(regLoadPower))
+	s.GridPower = int(int16(reg(regGridPower)))
+	s.GridVoltage = float64(reg(regGridVoltage)) / 10
+	s.BatteryPower = int(int16(reg(regBatteryPower)))
+	s.BatteryVoltage = float64(reg(regBatteryVoltage)) / 100
+	s.BatteryTemperature = temperature(reg(regBatteryTemperature))
+	s.InverterTemperature = temperature(temp[0])
+	return s, nil
+}
+
+// Settings reads the inverter's settings. The battery capacity is the capacity of
+// the first time-of-use program.
+func (inv *Inverter) Settings(ctx context.Context) (api.Settings, error) {
+	var settings api.Settings
+	low, err := inv.client.ReadHoldingRegisters(ctx, regBatteryLowCapacity, 1)
+	if err != nil {
+		return settings, err
+	}
+	limit, err := inv.client.ReadHoldingRegisters(ctx, regLoadLimit, 1)
+	if err != nil {
+		return settings, err
+	}
+	capacity, err := inv.client.ReadHoldingRegisters(ctx, regProgramCapacity, 1)
+	if err != nil {
+		return settings, err
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.setLoadLimit(limit[0])
+	settings.LowBatteryCapacity = int(low[0])
+	settings.EssentialOnly = limit[0] == essentialsOnly
+	settings.BatteryCapacity = int(capacity[0])
+	return settings, nil
+}
+
+// UpdateSettings writes changes to the inverter's settings. The battery capacity
+// is written to all of the time-of-use programs. When the inverter is allowed to
+// power all loads, the load limit that was last read (other than essentials only)
+// is restored; the load limit is read before it is first written.
+func (inv *Inverter) UpdateSettings(ctx context.Context, u api.Update) error {
+	if u.BatteryCapacity != nil {
+		values := make([]uint16, programs)
+		for i := range values {
+			values[i] = uint16(*u.BatteryCapacity)
+		}
+		if err := inv.client.WriteRegisters(ctx, regProgramCapacity, values...); err != nil {
+			return err
+		}
+	}
+	if u.EssentialOnly != nil {
+		limit, err := inv.allLoadsLimit(ctx)
+		if err != nil {
+			return err
+		}
+		if *u.EssentialOnly {
+			limit = essentialsOnly
+		}
+		if err := inv.client.WriteRegisters(ctx, regLoadLimit, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RatedPower reads the inverter's rated power in watts.
+func (inv *Inverter) RatedPower(ctx context.Context) (int, error) {
+	p, err := inv.client.ReadHoldingRegisters(ctx, regRatedPower, 2)
+	if err != nil {
+		return 0, err
+	}
+	return int(uint32(p[1])<<16|uint32(p[0])) / 10, nil
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package modbus communicates with a SunSynk inverter over Modbus RTU (using an
+// RS485 adapter), Modbus TCP (using a gateway) or the Solarman V5 protocol (using
+// the inverter's Wi-Fi data logger) so that gnomon can manage the inverter without
+// the SunSynk API.
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+// Modbus function codes.
+const (
+	readHoldingRegisters   = 0x03
+	writeMultipleRegisters = 0x10
+)
+
+// maxRegisters is the largest number of registers that can be read in one request.
+const maxRegisters = 125
+
+const (
+	defaultSlaveID  = 1
+	defaultBaudRate = 9600
+	defaultTimeout  = 5 * time.Second
+)
+
+// exceptions are the descriptions of Modbus exception codes.
+var exceptions = map[byte]string{
+	1: "illegal function",
+	2: "illegal data address",
+	3: "illegal data value",
+	4: "server device failure",
+	6: "server device busy",
+}
+
+// Exception is an error reported by the inverter.
+type Exception byte
+
+func (e Exception) Error() string {
+	if s, ok := exceptions[byte(e)]; ok {
+		return "modbus exception: " + s
+	}
+	return fmt.Sprintf("modbus exception %d", byte(e))
+}
+
+// conn is a connection that supports deadlines, such as a TCP connection or a
+// serial device.
+type conn interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// framer encodes requests for, and decodes responses from, a connection.
+type framer interface {
+	send(c conn, slave byte, pdu []byte) ([]byte, error)
+}
+
+// link is a connection to a bus or gateway. It can be shared by the clients of
+// several inverters, e.g. inverters on one RS485 bus with different slave IDs,
+// and sends one request at a time. The connection is opened when it is first
+// needed and is reopened after an error.
+type link struct {
+	mutex   sync.Mutex
+	dial    func() (conn, error)
+	framer  framer
+	timeout time.Duration
+	conn    conn
+}
+
+// Client sends Modbus requests to the inverter with a slave ID.
+type Client struct {
+	link  *link
+	slave byte
+}
+
+// New returns a client for the Modbus URL in the configuration.
+func New(cfg config.Modbus) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	l := &link{timeout: cfg.Timeout}
+	if l.timeout == 0 {
+		l.timeout = defaultTimeout
+	}
+	switch u.Scheme {
+	case "tcp":
+		l.framer = &tcpFramer{}
+		l.dial = dialTCP(u.Host, l.timeout)
+	case "rtu+tcp":
+		l.framer = rtuFramer{}
+		l.dial = dialTCP(u.Host, l.timeout)
+	case "solarman":
+		l.framer = &solarmanFramer{serial: cfg.LoggerSerial}
+		l.dial = dialTCP(u.Host, l.timeout)
+	case "rtu":
+		baud := cfg.BaudRate
+		if baud == 0 {
+			baud = defaultBaudRate
+		}
+		l.framer = rtuFramer{}
+		l.dial = func() (conn, error) {
+			return openSerial(u.Path, baud)
+		}
+	}
+	c := &Client{link: l}
+	return c.ForSlave(cfg.SlaveID), nil
+}
+
+func dialTCP(addr string, timeout time.Duration) func() (conn, error) {
+	return func() (conn, error) {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+}
+
+// ForSlave returns a client for the inverter with the slave ID (or the default
+// slave ID if it is zero) that shares c's connection.
+func (c *Client) ForSlave(id int) *Client {
+	if id == 0 {
+		id = defaultSlaveID
+	}
+	return &Client{link: c.link, slave: byte(id)}
+}
+
+// Close closes the connection to the inverter. The connection is closed for all
+// the clients that share it.
+func (c *Client) Close() error {
+	l := c.link
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+// send sends a request PDU and returns the response PDU.
+func (c *Client) send(ctx context.Context, pdu []byte) ([]byte, error) {
+	l := c.link
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		conn, err := l.dial()
+		if err != nil {
+			return nil, err
+		}
+		l.conn = conn
+	}
+	deadline := time.Now().Add(l.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := l.conn.SetDeadline(deadline); err != nil && !errors.Is(err, os.ErrNoDeadline) {
+		return nil, err
+	}
+	resp, err := l.framer.send(l.conn, c.slave, pdu)
+	if err != nil {
+		var e Exception
+		if !errors.As(err, &e) {
+			// The connection may be out of step with the inverter; start afresh.
+			l.conn.Close()
+			l.conn = nil
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkResponse checks that a response PDU is for the function and isn't an exception.
+func checkResponse(pdu []byte, function byte) error {
+	if len(pdu) < 2 {
+		return errors.New("modbus response is too short")
+	}
+	if pdu[0] == function|0x80 {
+		return Exception(pdu[1])
+	}
+	if pdu[0] != function {
+		return fmt.Errorf("modbus response is for function %d, not %d", pdu[0], function)
+	}
+	return nil
+}
+
+// ReadHoldingRegisters reads count holding registers starting at addr.
+func (c *Client) ReadHoldingRegisters(ctx context.Context, addr uint16, count uint16) ([]uint16, error) {
+	if count == 0 || count > maxRegisters {
+		return nil, fmt.Errorf("can't read %d registers", count)
+	}
+	pdu := []byte{readHoldingRegisters, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(pdu[1:], addr)
+	binary.BigEndian.PutUint16(pdu[3:], count)
+	resp, err := c.send(ctx, pdu)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkResponse(resp, readHoldingRegisters); err != nil {
+		return nil, err
+	}
+	if int(resp[1]) != 2*int(count) || len(resp) != 2+2*int(count) {
+		return nil, fmt.Errorf("expected %d registers, got %d bytes", count, resp[1])
+	}
+	values := make([]uint16, count)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(resp[2+2*i:])
+	}
+	return values, nil
+}
+
+// WriteRegisters writes values to the holding registers starting at addr.
+func (c *Client) WriteRegisters(ctx context.Context, addr uint16, values ...uint16) error {
+	if len(values) == 0 || len(values) > maxRegisters {
+		return fmt.Errorf("can't write %d registers", len(values))
+	}
+	pdu := make([]byte, 6+2*len(values))
+	pdu[0] = writeMultipleRegisters
+	binary.BigEndian.PutUint16(pdu[1:], addr)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(2 * len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(pdu[6+2*i:], v)
+	}
+	resp, err := c.send(ctx, pdu)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, writeMultipleRegisters)
+}
@@ -0,0 +1,246 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hammingweight/gnomon/api"
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestCrc16(t *testing.T) {
+	frame := rtuFrame(1, []byte{readHoldingRegisters, 0, 0, 0, 10})
+	if frame[6] != 0xc5 || frame[7] != 0xcd {
+		t.Errorf("expected crc c5cd, got %x", frame[6:])
+	}
+}
+
+func TestRtuResponseLength(t *testing.T) {
+	tests := []struct {
+		function byte
+		first    byte
+		expected int
+		err      bool
+	}{
+		{readHoldingRegisters, 20, 22, false},
+		{writeMultipleRegisters, 0, 5, false},
+		{readHoldingRegisters | 0x80, 2, 2, false},
+		{writeMultipleRegisters | 0x80, 4, 2, false},
+		{0x05, 0, 0, true},
+	}
+	for _, test := range tests {
+		n, err := rtuResponseLength(test.function, test.first)
+		if (err != nil) != test.err {
+			t.Errorf("function %d: unexpected error %v", test.function, err)
+		}
+		if n != test.expected {
+			t.Errorf("function %d: expected %d, got %d", test.function, test.expected, n)
+		}
+	}
+}
+
+func TestRtuPDU(t *testing.T) {
+	read := rtuFrame(1, []byte{readHoldingRegisters, 2, 0, 60})
+	exception := rtuFrame(1, []byte{readHoldingRegisters | 0x80, 2})
+	write := rtuFrame(1, []byte{writeMultipleRegisters, 1, 12, 0, 6})
+	badCrc := append([]byte{}, read...)
+	badCrc[len(badCrc)-1] ^= 0xff
+	tests := []struct {
+		frame    []byte
+		slave    byte
+		expected []byte
+		err      bool
+	}{
+		{read, 1, []byte{readHoldingRegisters, 2, 0, 60}, false},
+		{exception, 1, []byte{readHoldingRegisters | 0x80, 2}, false},
+		{write, 1, []byte{writeMultipleRegisters, 1, 12, 0, 6}, false},
+		{badCrc, 1, nil, true},
+		{read, 2, nil, true},
+		{read[:3], 1, nil, true},
+	}
+	for i, test := range tests {
+		pdu, err := rtuPDU(test.frame, test.slave)
+		if (err != nil) != test.err {
+			t.Errorf("test %d: unexpected error %v", i, err)
+		}
+		if !bytes.Equal(pdu, test.expected) {
+			t.Errorf("test %d: expected %x, got %x", i, test.expected, pdu)
+		}
+	}
+}
+
+func startSimulator(t *testing.T) (*Simulator, *Client) {
+	t.Helper()
+	sim := NewSimulator()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go sim.Serve(l)
+	client, err := New(config.Modbus{URL: "tcp://" + l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return sim, client
+}
+
+func TestInverter(t *testing.T) {
+	sim, client := startSimulator(t)
+	sim.Set(regGridPower, uint16(0xffff-99))
+	inv := NewInverter(client)
+	ctx := context.Background()
+
+	s, err := inv.ReadState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Power != 1500 || s.Soc != 60 || s.Load != 800 || s.GridPower != -100 {
+		t.Errorf("unexpected state %v", s)
+	}
+	if s.GridVoltage != 230 || s.BatteryVoltage != 52 || s.BatteryTemperature != 25 || s.PV[1].Voltage != 300 {
+		t.Errorf("unexpected state %v", s)
+	}
+
+	power, err := inv.RatedPower(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if power != 5000 {
+		t.Errorf("expected %d, got %d", 5000, power)
+	}
+
+	settings, err := inv.Settings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.BatteryCapacity != 40 || settings.LowBatteryCapacity != 20 || !settings.EssentialOnly {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+
+	capacity := 35
+	eo := false
+	if err = inv.UpdateSettings(ctx, api.Update{BatteryCapacity: &capacity, EssentialOnly: &eo}); err != nil {
+		t.Fatal(err)
+	}
+	if v := sim.Get(regProgramCapacity + programs - 1); v != 35 {
+		t.Errorf("expected %d, got %d", 35, v)
+	}
+	if v := sim.Get(regLoadLimit); v != zeroExport {
+		t.Errorf("expected %d, got %d", zeroExport, v)
+	}
+}
+
+func TestLoadLimitRestored(t *testing.T) {
+	sim, client := startSimulator(t)
+	sim.Set(regLoadLimit, allowExport)
+	inv := NewInverter(client)
+	ctx := context.Background()
+
+	// The inverter's own load limit is restored even though the settings weren't
+	// read before the first write.
+	for _, eo := range []bool{true, false} {
+		if err := inv.UpdateSettings(ctx, api.Update{EssentialOnly: &eo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := sim.Get(regLoadLimit); v != allowExport {
+		t.Errorf("expected %d, got %d", allowExport, v)
+	}
+}
+
+func TestException(t *testing.T) {
+	_, client := startSimulator(t)
+	_, err := client.ReadHoldingRegisters(context.Background(), 65500, 100)
+	if err != Exception(2) {
+		t.Errorf("expected an illegal data address exception, got %v", err)
+	}
+	// The connection is still usable after an exception.
+	if _, err = client.ReadHoldingRegisters(context.Background(), 0, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSolarman(t *testing.T) {
+	sim := NewSimulator()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go sim.ServeSolarman(l, 2712345678)
+
+	if _, err = New(config.Modbus{URL: "solarman://" + l.Addr().String()}); err == nil {
+		t.Error("expected an error without the logger's serial number")
+	}
+	client, err := New(config.Modbus{URL: "solarman://" + l.Addr().String(), LoggerSerial: 2712345678})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	inv := NewInverter(client)
+
+	s, err := inv.ReadState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Soc != 60 || s.Power != 1500 {
+		t.Errorf("unexpected state %v", s)
+	}
+	eo := false
+	if err = inv.UpdateSettings(context.Background(), api.Update{EssentialOnly: &eo}); err != nil {
+		t.Fatal(err)
+	}
+	if v := sim.Get(regLoadLimit); v != zeroExport {
+		t.Errorf("expected %d, got %d", zeroExport, v)
+	}
+}
+
+// countingListener counts the connections that it accepts.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return c, err
+}
+
+func TestForSlave(t *testing.T) {
+	sim := NewSimulator()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &countingListener{Listener: tcp}
+	t.Cleanup(func() { l.Close() })
+	go sim.Serve(l)
+	first, err := New(config.Modbus{URL: "tcp://" + l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { first.Close() })
+	second := first.ForSlave(2)
+	if first.slave != defaultSlaveID || second.slave != 2 {
+		t.Errorf("expected slaves %d and %d, got %d and %d", defaultSlaveID, 2, first.slave, second.slave)
+	}
+
+	// Both inverters are reached over the same connection.
+	ctx := context.Background()
+	for _, c := range []*Client{first, second, first} {
+		if _, err = c.ReadHoldingRegisters(ctx, regLoadLimit, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := l.accepted.Load(); n != 1 {
+		t.Errorf("expected %d, got %d", 1, n)
+	}
+}
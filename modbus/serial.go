@@ -0,0 +1,25 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import "os"
+
+// openSerial opens an RS485 adapter. The adapter's baud rate can only be set on
+// Linux; on other systems it must be configured beforehand, e.g. with stty.
+var openSerial = func(path string, baud int) (conn, error) {
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
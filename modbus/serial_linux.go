@@ -0,0 +1,75 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var baudRates = map[int]uint32{
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+func init() {
+	openSerial = openTermios
+}
+
+// openTermios opens an RS485 adapter and configures it for 8 data bits, no parity
+// and one stop bit at the baud rate.
+func openTermios(path string, baud int) (conn, error) {
+	rate, ok := baudRates[baud]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", baud)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	t := syscall.Termios{
+		Iflag:  syscall.IGNPAR,
+		Cflag:  syscall.CS8 | syscall.CREAD | syscall.CLOCAL | rate,
+		Ispeed: rate,
+		Ospeed: rate,
+	}
+	t.Cc[syscall.VMIN] = 1
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	})
+	if err == nil && errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("can't configure %s: %w", path, err)
+	}
+	return f, nil
+}
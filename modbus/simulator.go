@@ -0,0 +1,139 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Simulator is a Modbus TCP server holding a bank of registers. It can be used to
+// test gnomon without an inverter.
+type Simulator struct {
+	mutex     sync.Mutex
+	registers [65536]uint16
+}
+
+// NewSimulator returns a simulator with the registers of an inverter with a 5kW
+// rating, a battery at 60% SoC and the load limited to the essential loads.
+func NewSimulator() *Simulator {
+	s := &Simulator{}
+	s.Set(regRatedPower, 50000, 0)
+	s.Set(regInverterTemperature, 1350)
+	s.Set(regPV1Voltage, 3200, 0, 3000)
+	s.Set(regGridVoltage, 2300)
+	s.Set(regLoadPower, 800)
+	s.Set(regBatteryTemperature, 1250, 5200, 60)
+	s.Set(regPV1Power, 900, 600)
+	s.Set(regBatteryLowCapacity, 20)
+	s.Set(regLoadLimit, essentialsOnly)
+	s.Set(regProgramCapacity, 40, 40, 40, 40, 40, 40)
+	return s
+}
+
+// Set sets the registers starting at addr.
+func (s *Simulator) Set(addr uint16, values ...uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	copy(s.registers[addr:], values)
+}
+
+// Get returns the value of the register at addr.
+func (s *Simulator) Get(addr uint16) uint16 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.registers[addr]
+}
+
+// Serve accepts Modbus TCP connections until the listener is closed.
+func (s *Simulator) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+func (s *Simulator) serveConn(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint16(header[4:])
+		if length < 2 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(r, pdu); err != nil {
+			return
+		}
+		resp := s.handle(pdu)
+		binary.BigEndian.PutUint16(header[4:], uint16(1+len(resp)))
+		if _, err := c.Write(append(header, resp...)); err != nil {
+			log.Println("Modbus simulator failed to respond: ", err)
+			return
+		}
+	}
+}
+
+// handle returns the response to a request PDU.
+func (s *Simulator) handle(pdu []byte) []byte {
+	exception := func(code byte) []byte {
+		return []byte{pdu[0] | 0x80, code}
+	}
+	if len(pdu) < 5 {
+		return exception(3)
+	}
+	addr := binary.BigEndian.Uint16(pdu[1:])
+	count := binary.BigEndian.Uint16(pdu[3:])
+	if count == 0 || count > maxRegisters || int(addr)+int(count) > len(s.registers) {
+		return exception(2)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch pdu[0] {
+	case readHoldingRegisters:
+		resp := []byte{readHoldingRegisters, byte(2 * count)}
+		for i := uint16(0); i < count; i++ {
+			resp = binary.BigEndian.AppendUint16(resp, s.registers[addr+i])
+		}
+		return resp
+	case writeMultipleRegisters:
+		if len(pdu) != 6+2*int(count) {
+			return exception(3)
+		}
+		for i := uint16(0); i < count; i++ {
+			s.registers[addr+i] = binary.BigEndian.Uint16(pdu[6+2*i:])
+		}
+		return pdu[:5]
+	}
+	return exception(1)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// Solarman V5 frames wrap Modbus RTU frames sent to a Solarman data logger.
+const (
+	solarmanStart    = 0xa5
+	solarmanEnd      = 0x15
+	solarmanRequest  = 0x4510
+	solarmanResponse = 0x1510
+	// solarmanHeader is the length of the start byte, length, control code,
+	// sequence number and logger serial number.
+	solarmanHeader = 11
+	// solarmanRequestPrefix and solarmanResponsePrefix are the lengths of the
+	// payload fields that precede the Modbus frame.
+	solarmanRequestPrefix  = 15
+	solarmanResponsePrefix = 14
+)
+
+// solarmanChecksum returns the checksum of a frame, which is the sum of the bytes
+// after the start byte and before the checksum.
+func solarmanChecksum(frame []byte) byte {
+	var sum byte
+	for _, b := range frame[1:] {
+		sum += b
+	}
+	return sum
+}
+
+// solarmanFrame wraps a payload in a Solarman V5 frame.
+func solarmanFrame(control uint16, sequence uint16, serial uint32, payload []byte) []byte {
+	frame := []byte{solarmanStart}
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(len(payload)))
+	frame = binary.LittleEndian.AppendUint16(frame, control)
+	frame = binary.LittleEndian.AppendUint16(frame, sequence)
+	frame = binary.LittleEndian.AppendUint32(frame, serial)
+	frame = append(frame, payload...)
+	return append(frame, solarmanChecksum(frame), solarmanEnd)
+}
+
+// readSolarmanFrame reads a frame and returns its control code, sequence number
+// and payload.
+func readSolarmanFrame(r io.Reader) (uint16, uint16, []byte, error) {
+	header := make([]byte, solarmanHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	if header[0] != solarmanStart {
+		return 0, 0, nil, errors.New("solarman frame has an invalid start byte")
+	}
+	length := binary.LittleEndian.Uint16(header[1:])
+	rest := make([]byte, int(length)+2)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, nil, err
+	}
+	frame := append(header, rest...)
+	if frame[len(frame)-1] != solarmanEnd || frame[len(frame)-2] != solarmanChecksum(frame[:len(frame)-2]) {
+		return 0, 0, nil, errors.New("solarman frame has a bad checksum")
+	}
+	control := binary.LittleEndian.Uint16(header[3:])
+	sequence := binary.LittleEndian.Uint16(header[5:])
+	return control, sequence, rest[:length], nil
+}
+
+// solarmanFramer wraps Modbus RTU frames in Solarman V5 frames.
+type solarmanFramer struct {
+	serial   uint32
+	sequence uint16
+}
+
+func (f *solarmanFramer) send(c conn, slave byte, pdu []byte) ([]byte, error) {
+	f.sequence++
+	payload := make([]byte, solarmanRequestPrefix)
+	payload[0] = 0x02
+	payload = append(payload, rtuFrame(slave, pdu)...)
+	if _, err := c.Write(solarmanFrame(solarmanRequest, f.sequence, f.serial, payload)); err != nil {
+		return nil, err
+	}
+
+	for {
+		control, sequence, payload, err := readSolarmanFrame(c)
+		if err != nil {
+			return nil, err
+		}
+		// Skip heartbeats and late responses to earlier requests.
+		if control != solarmanResponse || sequence&0xff != f.sequence&0xff {
+			continue
+		}
+		if len(payload) <= solarmanResponsePrefix {
+			return nil, errors.New("solarman logger didn't get a response from the inverter")
+		}
+		return rtuPDU(payload[solarmanResponsePrefix:], slave)
+	}
+}
+
+// ServeSolarman accepts connections as if it were a Solarman data logger with the
+// serial number until the listener is closed.
+func (s *Simulator) ServeSolarman(l net.Listener, serial uint32) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveSolarmanConn(c, serial)
+	}
+}
+
+func (s *Simulator) serveSolarmanConn(c net.Conn, serial uint32) {
+	defer c.Close()
+	for {
+		control, sequence, payload, err := readSolarmanFrame(c)
+		if err != nil {
+			return
+		}
+		if control != solarmanRequest || len(payload) < solarmanRequestPrefix+4 {
+			continue
+		}
+		frame := payload[solarmanRequestPrefix:]
+		body := frame[:len(frame)-2]
+		if binary.LittleEndian.Uint16(frame[len(frame)-2:]) != crc16(body) {
+			continue
+		}
+		resp := make([]byte, solarmanResponsePrefix)
+		resp[0] = 0x02
+		resp[1] = 0x01
+		resp = append(resp, rtuFrame(body[0], s.handle(body[1:]))...)
+		if _, err = c.Write(solarmanFrame(solarmanResponse, sequence, serial, resp)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications of significant events, such as changes to the
+// inverter's settings or repeated failures, to configurable sinks.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+// Types of event.
+const (
+	ThresholdChanged     = "threshold_changed"
+	CtSwitched           = "ct_switched"
+	APIFailures          = "api_failures"
+	AuthenticationFailed = "authentication_failed"
+	PermissionDenied     = "permission_denied"
+	GaveUp               = "gave_up"
+	GridOutage           = "grid_outage"
+	GridRestored         = "grid_restored"
+	ManualOverride       = "manual_override"
+)
+
+// Event is a notification of something significant that happened.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s [%s] %s", e.Time.Format(time.DateTime), e.Type, e.Message)
+}
+
+// Sink is a destination for events.
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+type notifier struct {
+	mutex  sync.Mutex
+	wg     sync.WaitGroup
+	events []string
+	sinks  []Sink
+}
+
+var n notifier
+
+// sendTimeout is how long a sink has to deliver an event.
+const sendTimeout = 30 * time.Second
+
+// Configure sets up the sinks specified in the configuration.
+func Configure(cfg config.Notifications) {
+	sinks := []Sink{}
+	for _, w := range cfg.Webhooks {
+		sinks = append(sinks, &Webhook{URL: w.URL, Headers: w.Headers})
+	}
+	for _, e := range cfg.Email {
+		sinks = append(sinks, &Email{Host: e.Host, Port: e.Port, Username: e.Username, Password: e.Password, From: e.From, To: e.To})
+	}
+	for _, c := range cfg.Commands {
+		sinks = append(sinks, &Command{Command: c.Command, Args: c.Args})
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.events = cfg.Events
+	n.sinks = sinks
+}
+
+// Notify sends an event to all sinks. The event is sent asynchronously; failures
+// to deliver the event are logged.
+func Notify(eventType string, format string, args ...any) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if len(n.events) > 0 && !slices.Contains(n.events, eventType) {
+		return
+	}
+	e := Event{Time: time.Now(), Type: eventType, Message: fmt.Sprintf(format, args...)}
+	for _, s := range n.sinks {
+		n.wg.Add(1)
+		go func(s Sink) {
+			defer n.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := s.Send(ctx, e); err != nil {
+				log.Println("Failed to send notification: ", err)
+			}
+		}(s)
+	}
+}
+
+// Wait waits for all events to be delivered.
+func Wait() {
+	n.wg.Wait()
+}
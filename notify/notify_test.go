@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/hammingweight/gnomon/config"
+)
+
+func TestWebhook(t *testing.T) {
+	events := make(chan Event, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected an authorization header, got %q", r.Header.Get("Authorization"))
+		}
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		events <- e
+	}))
+	defer server.Close()
+
+	Configure(config.Notifications{
+		Events:   []string{ThresholdChanged},
+		Webhooks: []config.Webhook{{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}},
+	})
+	defer Configure(config.Notifications{})
+
+	Notify(CtSwitched, "not sent")
+	Notify(ThresholdChanged, "threshold changed from %d%% to %d%%", 40, 45)
+	Wait()
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	e := <-events
+	if e.Type != ThresholdChanged || e.Message != "threshold changed from 40% to 45%" {
+		t.Errorf("unexpected event %v", e)
+	}
+}
+
+func TestEventTypes(t *testing.T) {
+	// The configuration can only name events that are sent.
+	events := []string{ThresholdChanged, CtSwitched, APIFailures, AuthenticationFailed, PermissionDenied, GaveUp, GridOutage, GridRestored, ManualOverride}
+	if len(events) != len(config.EventTypes) {
+		t.Errorf("expected %d, got %d", len(events), len(config.EventTypes))
+	}
+	for _, e := range events {
+		if !slices.Contains(config.EventTypes, e) {
+			t.Errorf("expected %s to be a configurable event", e)
+		}
+	}
+}
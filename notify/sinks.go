@@ -0,0 +1,121 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Webhook posts events as JSON to a URL.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Send posts the event to the webhook's URL.
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Email sends events by email via an SMTP server.
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send emails the event.
+func (m *Email) Send(ctx context.Context, e Event) error {
+	port := m.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	msg := &strings.Builder{}
+	fmt.Fprintf(msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(msg, "Subject: gnomon: %s\r\n", e.Type)
+	fmt.Fprintf(msg, "\r\n%s\r\n", e)
+
+	// smtp.SendMail doesn't accept a context so run it in the background.
+	errCh := make(chan error, 1)
+	go func() {
+		addr := net.JoinHostPort(m.Host, strconv.Itoa(port))
+		errCh <- smtp.SendMail(addr, auth, m.From, m.To, []byte(msg.String()))
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Command runs a local command with the event as JSON on its stdin.
+type Command struct {
+	Command string
+	Args    []string
+}
+
+// Send runs the command.
+func (c *Command) Send(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", c.Command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
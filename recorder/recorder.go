@@ -0,0 +1,232 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package recorder appends the inverter's states and every read or write of the
+// inverter's settings to files that are rotated daily. The files can be written as
+// CSV or as JSON lines and are the input for backtesting.
+package recorder
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+// Formats that can be recorded.
+const (
+	CSV       = "csv"
+	JSONLines = "jsonl"
+)
+
+// Types of JSON lines records.
+const (
+	StateRecord   = "state"
+	SettingRecord = "setting"
+)
+
+// Record is a line in a JSON lines recording.
+type Record struct {
+	Type     string            `json:"type"`
+	Recorded time.Time         `json:"recorded"`
+	State    *api.State        `json:"state,omitempty"`
+	Setting  *api.SettingEvent `json:"setting,omitempty"`
+}
+
+var settingsHeader = []string{"recorded", "operation", "setting", "value"}
+
+// dailyFile is a file that is replaced by a new file each day.
+type dailyFile struct {
+	prefix string
+	header []string
+	date   string
+	file   *os.File
+}
+
+func (d *dailyFile) writer(dir string, ext string, now time.Time) (io.Writer, bool, error) {
+	date := now.Format(time.DateOnly)
+	if d.file != nil && d.date == date {
+		return d.file, false, nil
+	}
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", d.prefix, date, ext))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	d.file = f
+	d.date = date
+	return f, info.Size() == 0, nil
+}
+
+func (d *dailyFile) close() error {
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// Recorder writes states and settings events to daily files in a directory.
+type Recorder struct {
+	mutex    sync.Mutex
+	dir      string
+	format   string
+	states   dailyFile
+	settings dailyFile
+	last     time.Time
+	closed   bool
+}
+
+// New returns a recorder that writes files in the specified format to dir. States
+// and settings events are written to the same file as JSON lines; CSV recordings
+// write settings events to a separate file.
+func New(dir string, format string) (*Recorder, error) {
+	if format != CSV && format != JSONLines {
+		return nil, fmt.Errorf("unknown recording format %q, must be %s or %s", format, CSV, JSONLines)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		dir:      dir,
+		format:   format,
+		states:   dailyFile{prefix: "gnomon", header: api.CSVHeader},
+		settings: dailyFile{prefix: "gnomon-settings", header: settingsHeader},
+	}
+	return r, nil
+}
+
+func (r *Recorder) writeCSV(d *dailyFile, record []string) error {
+	w, isNew, err := d.writer(r.dir, CSV, time.Now())
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if isNew {
+		cw.Write(d.header)
+	}
+	cw.Write(record)
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *Recorder) writeJSON(record Record) error {
+	w, _, err := r.states.writer(r.dir, JSONLines, record.Recorded)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// RecordState records the inverter's state. A state that has the same time as the
+// previous state, e.g. a stale state that is sent again, isn't recorded. Nothing is
+// recorded after the recorder is closed.
+func (r *Recorder) RecordState(s api.State) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || s.Time.Equal(r.last) {
+		return nil
+	}
+	r.last = s.Time
+
+	if r.format == CSV {
+		return r.writeCSV(&r.states, s.CSVRecord())
+	}
+	return r.writeJSON(Record{Type: StateRecord, Recorded: time.Now(), State: &s})
+}
+
+// RecordSetting records a read or write of one of the inverter's settings. Nothing
+// is recorded after the recorder is closed.
+func (r *Recorder) RecordSetting(e api.SettingEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	if r.format == CSV {
+		return r.writeCSV(&r.settings, []string{e.Time.Format(time.RFC3339), e.Operation, e.Setting, fmt.Sprint(e.Value)})
+	}
+	return r.writeJSON(Record{Type: SettingRecord, Recorded: time.Now(), Setting: &e})
+}
+
+// Close closes the recorder's files; later states and events are ignored.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	err := r.states.close()
+	if e := r.settings.close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// ReadStates reads the states from a recording. Files with a .jsonl extension are
+// read as JSON lines; other files are read as CSV.
+func ReadStates(path string) ([]api.State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, "."+JSONLines) {
+		return api.ReadCSV(f)
+	}
+
+	states := []api.State{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if record.Type == StateRecord && record.State != nil {
+			states = append(states, *record.State)
+		}
+	}
+	return states, scanner.Err()
+}
@@ -0,0 +1,70 @@
+package recorder
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/api"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	for _, format := range []string{CSV, JSONLines} {
+		dir := t.TempDir()
+		r, err := New(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := api.State{
+			Power:     1500,
+			Soc:       75,
+			Load:      600,
+			GridPower: -200,
+			PV:        []api.MPPT{{Power: 1000, Voltage: 350.5}, {Power: 500, Voltage: 300}},
+			Time:      time.Date(2025, 5, 23, 12, 0, 0, 0, time.UTC),
+		}
+		if err = r.RecordState(s); err != nil {
+			t.Fatal(err)
+		}
+		// A stale state that is sent again isn't recorded twice.
+		if err = r.RecordState(s); err != nil {
+			t.Fatal(err)
+		}
+		if err = r.RecordSetting(api.SettingEvent{Time: time.Now(), Operation: api.Write, Setting: api.EssentialOnlySetting, Value: false}); err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Events after the recorder is closed don't reopen the files.
+		if err = r.RecordSetting(api.SettingEvent{Time: time.Now(), Operation: api.Read, Setting: api.EssentialOnlySetting, Value: false}); err != nil {
+			t.Fatal(err)
+		}
+		if r.settings.file != nil || r.states.file != nil {
+			t.Errorf("expected the %s recording to stay closed", format)
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "gnomon-2*."+format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("expected one %s recording, got %d", format, len(files))
+		}
+		states, err := ReadStates(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) != 1 {
+			t.Fatalf("expected one %s state, got %d", format, len(states))
+		}
+		actual := states[0]
+		if actual.Power != s.Power || actual.Soc != s.Soc || actual.GridPower != s.GridPower || !actual.Time.Equal(s.Time) {
+			t.Errorf("expected %v, got %v", s, actual)
+		}
+		if len(actual.PV) != 2 || actual.PV[0].Voltage != 350.5 {
+			t.Errorf("expected MPPT values %v, got %v", s.PV, actual.PV)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/hammingweight/gnomon/history"
+)
+
+// Formats that a report can be written in.
+const (
+	Markdown = "markdown"
+	HTML     = "html"
+	JSON     = "json"
+)
+
+var headings = []string{
+	"Period", "Threshold", "SoC", "CT on", "Switches", "PV (kWh)", "Load (kWh)",
+	"Grid import (kWh)", "Grid export (kWh)", "PV while CT on (kWh)", "Load not from grid (kWh)", "Cost",
+}
+
+// threshold formats a discharge threshold; an unknown threshold is shown as "?".
+func threshold(t int) string {
+	if t == history.UnknownThreshold {
+		return "?"
+	}
+	return fmt.Sprintf("%d%%", t)
+}
+
+func cells(r Row) []string {
+	kwh := func(wh float64) string {
+		return fmt.Sprintf("%.1f", wh/1000)
+	}
+	return []string{
+		r.Period,
+		threshold(r.StartThreshold) + " → " + threshold(r.EndThreshold),
+		fmt.Sprintf("%d%% - %d%%", r.MinSoc, r.MaxSoc),
+		r.CtOnTime.Round(time.Minute).String(),
+		fmt.Sprintf("%d", r.Switches),
+		kwh(r.Energy.PV),
+		kwh(r.Energy.Load),
+		kwh(r.Energy.GridImport),
+		kwh(r.Energy.GridExport),
+		kwh(r.AllLoads.PV),
+		kwh(r.LoadNotFromGrid),
+		fmt.Sprintf("%.2f", r.LoadNotFromGridCost),
+	}
+}
+
+func writeMarkdown(w io.Writer, rows []Row) error {
+	line := func(cols []string) error {
+		_, err := fmt.Fprint(w, "|")
+		for _, c := range cols {
+			if _, err = fmt.Fprintf(w, " %s |", c); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	}
+	if err := line(headings); err != nil {
+		return err
+	}
+	separator := make([]string, len(headings))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	if err := line(separator); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := line(cells(r)); err != nil {
+			return err
+		}
+	}
+	return line(cells(Total(rows)))
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gnomon report</title>
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 4px 8px; text-align: right; }
+tr.total { font-weight: bold; }
+</style>
+</head>
+<body>
+<table>
+<tr>{{range .Headings}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}<tr class="total">{{range .Total}}<td>{{.}}</td>{{end}}</tr>
+</table>
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, rows []Row) error {
+	data := struct {
+		Headings []string
+		Rows     [][]string
+		Total    []string
+	}{headings, [][]string{}, cells(Total(rows))}
+	for _, r := range rows {
+		data.Rows = append(data.Rows, cells(r))
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+func writeJSON(w io.Writer, rows []Row) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Rows  []Row `json:"rows"`
+		Total Row   `json:"total"`
+	}{rows, Total(rows)})
+}
+
+// Write writes the rows, and a total, to w in the specified format.
+func Write(w io.Writer, format string, rows []Row) error {
+	switch format {
+	case Markdown:
+		return writeMarkdown(w, rows)
+	case HTML:
+		return writeHTML(w, rows)
+	case JSON:
+		return writeJSON(w, rows)
+	}
+	return fmt.Errorf("unknown report format %q, must be one of %s, %s or %s", format, Markdown, HTML, JSON)
+}
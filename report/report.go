@@ -0,0 +1,168 @@
+/*
+Copyright 2025 Carl Meijer.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report summarizes gnomon's history by day or by week.
+package report
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammingweight/gnomon/history"
+)
+
+// Row summarizes a day or a week.
+type Row struct {
+	Period         string         `json:"period"`
+	StartThreshold int            `json:"start_threshold"`
+	EndThreshold   int            `json:"end_threshold"`
+	MinSoc         int            `json:"min_soc"`
+	MaxSoc         int            `json:"max_soc"`
+	CtOnTime       time.Duration  `json:"-"`
+	CtOnHours      float64        `json:"ct_on_hours"`
+	Switches       int            `json:"switches"`
+	Energy         history.Energy `json:"energy"`
+	AllLoads       history.Energy `json:"all_loads"`
+	// LoadNotFromGrid is the load energy (in Wh) that was not drawn from the grid
+	// while the inverter powered all loads. It is an upper bound on the grid energy
+	// saved by powering all loads since it includes the essential loads, which the
+	// inverter would have powered anyway.
+	LoadNotFromGrid float64 `json:"load_not_from_grid_wh"`
+	// LoadNotFromGridCost is LoadNotFromGrid multiplied by the tariff.
+	LoadNotFromGridCost float64 `json:"load_not_from_grid_cost,omitempty"`
+}
+
+func (r *Row) merge(o Row) {
+	if r.Period == "" {
+		*r = o
+		return
+	}
+	r.EndThreshold = o.EndThreshold
+	r.MinSoc = min(r.MinSoc, o.MinSoc)
+	r.MaxSoc = max(r.MaxSoc, o.MaxSoc)
+	r.CtOnTime += o.CtOnTime
+	r.CtOnHours = r.CtOnTime.Hours()
+	r.Switches += o.Switches
+	r.Energy = r.Energy.Add(o.Energy)
+	r.AllLoads = r.AllLoads.Add(o.AllLoads)
+	r.LoadNotFromGrid += o.LoadNotFromGrid
+	r.LoadNotFromGridCost += o.LoadNotFromGridCost
+}
+
+func week(date string) (string, error) {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return "", err
+	}
+	y, w := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, w), nil
+}
+
+// forInverter returns the runs that managed the inverter with the serial number sn.
+// If sn is empty, the runs must all have managed the same inverter since the
+// energy totals and thresholds of different inverters can't be merged.
+func forInverter(runs []history.Run, sn string) ([]history.Run, error) {
+	if sn != "" {
+		return slices.DeleteFunc(slices.Clone(runs), func(r history.Run) bool {
+			return r.Inverter != sn
+		}), nil
+	}
+	sns := []string{}
+	for _, r := range runs {
+		if r.Inverter != "" && !slices.Contains(sns, r.Inverter) {
+			sns = append(sns, r.Inverter)
+		}
+	}
+	if len(sns) > 1 {
+		return nil, fmt.Errorf("the history has runs for inverters %s; select one of them", strings.Join(sns, ", "))
+	}
+	return slices.Clone(runs), nil
+}
+
+// Summarize summarizes the days in the runs of the inverter with the serial number
+// sn from the date from to the date to (inclusive, in YYYY-MM-DD format). sn may be
+// empty if the runs are all for one inverter. If weekly is true, the days are
+// summarized by ISO week. tariff is the cost of a kWh of grid energy and is used to
+// cost the load that was not drawn from the grid while the inverter powered all loads.
+func Summarize(runs []history.Run, sn string, from string, to string, weekly bool, tariff float64) ([]Row, error) {
+	rows := map[string]*Row{}
+	runs, err := forInverter(runs, sn)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Started.Before(runs[j].Started)
+	})
+	for _, run := range runs {
+		for _, d := range run.Days {
+			if (from != "" && d.Date < from) || (to != "" && d.Date > to) {
+				continue
+			}
+			period := d.Date
+			if weekly {
+				var err error
+				if period, err = week(d.Date); err != nil {
+					return nil, err
+				}
+			}
+			notFromGrid := max(d.AllLoads.Load-d.AllLoads.GridImport, 0)
+			ctOnTime := time.Duration(d.CtOnSeconds * float64(time.Second))
+			row := Row{
+				Period:              period,
+				StartThreshold:      run.StartThreshold,
+				EndThreshold:        run.EndThreshold,
+				MinSoc:              d.MinSoc,
+				MaxSoc:              d.MaxSoc,
+				CtOnTime:            ctOnTime,
+				CtOnHours:           ctOnTime.Hours(),
+				Switches:            d.Switches,
+				Energy:              d.Energy,
+				AllLoads:            d.AllLoads,
+				LoadNotFromGrid:     notFromGrid,
+				LoadNotFromGridCost: notFromGrid / 1000 * tariff,
+			}
+			if _, ok := rows[period]; !ok {
+				rows[period] = &Row{}
+			}
+			rows[period].merge(row)
+		}
+	}
+
+	summary := []Row{}
+	for _, r := range rows {
+		summary = append(summary, *r)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].Period < summary[j].Period
+	})
+	return summary, nil
+}
+
+// Total returns a row that totals all the rows.
+func Total(rows []Row) Row {
+	total := Row{}
+	for _, r := range rows {
+		total.merge(r)
+	}
+	total.Period = "Total"
+	if len(rows) > 0 {
+		total.StartThreshold = rows[0].StartThreshold
+	}
+	return total
+}
@@ -0,0 +1,101 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammingweight/gnomon/history"
+)
+
+func TestSummarize(t *testing.T) {
+	runs := []history.Run{
+		{
+			Started:        time.Date(2025, 5, 20, 6, 0, 0, 0, time.UTC),
+			StartThreshold: 40,
+			EndThreshold:   42,
+			Days: []history.Day{
+				{Date: "2025-05-20", MinSoc: 45, MaxSoc: 90, CtOnSeconds: 3600, Switches: 2,
+					AllLoads: history.Energy{Load: 3000, GridImport: 500}},
+			},
+		},
+		{
+			Started:        time.Date(2025, 5, 21, 6, 0, 0, 0, time.UTC),
+			StartThreshold: 42,
+			EndThreshold:   38,
+			Days: []history.Day{
+				{Date: "2025-05-21", MinSoc: 44, MaxSoc: 100, CtOnSeconds: 7200, Switches: 1,
+					AllLoads: history.Energy{Load: 1000}},
+			},
+		},
+	}
+
+	rows, err := Summarize(runs, "", "2025-05-21", "", false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Period != "2025-05-21" {
+		t.Fatalf("expected a row for 2025-05-21, got %v", rows)
+	}
+	if rows[0].LoadNotFromGridCost != 2 {
+		t.Errorf("expected a cost of 2, got %f", rows[0].LoadNotFromGridCost)
+	}
+
+	// The caller's runs aren't reordered.
+	runs[0], runs[1] = runs[1], runs[0]
+	rows, err = Summarize(runs, "", "", "", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs[0].StartThreshold != 42 {
+		t.Error("expected the runs to be left in their order")
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected one week, got %d", len(rows))
+	}
+	r := rows[0]
+	if r.Period != "2025-W21" {
+		t.Errorf("expected 2025-W21, got %s", r.Period)
+	}
+	if r.StartThreshold != 40 || r.EndThreshold != 38 {
+		t.Errorf("expected thresholds 40%% -> 38%%, got %d%% -> %d%%", r.StartThreshold, r.EndThreshold)
+	}
+	if r.MinSoc != 44 || r.MaxSoc != 100 {
+		t.Errorf("expected SoC 44%% - 100%%, got %d%% - %d%%", r.MinSoc, r.MaxSoc)
+	}
+	if r.CtOnTime != 3*time.Hour {
+		t.Errorf("expected CT on for 3h, got %s", r.CtOnTime)
+	}
+	if r.Switches != 3 {
+		t.Errorf("expected 3 switches, got %d", r.Switches)
+	}
+	if r.LoadNotFromGrid != 3500 {
+		t.Errorf("expected 3500Wh of load not from the grid, got %f", r.LoadNotFromGrid)
+	}
+}
+
+func TestUnknownThreshold(t *testing.T) {
+	c := cells(Row{Period: "2025-05-20", StartThreshold: 40, EndThreshold: history.UnknownThreshold})
+	if c[1] != "40% → ?" {
+		t.Errorf("expected %q, got %q", "40% → ?", c[1])
+	}
+}
+
+func TestSummarizeInverters(t *testing.T) {
+	runs := []history.Run{
+		{Inverter: "2102190001", StartThreshold: 40, Days: []history.Day{{Date: "2025-05-20", CtOnSeconds: 3600}}},
+		{Inverter: "2102190002", StartThreshold: 30, Days: []history.Day{{Date: "2025-05-20", CtOnSeconds: 7200}}},
+	}
+	if _, err := Summarize(runs, "", "", "", false, 0); err == nil {
+		t.Error("expected an error summarizing several inverters")
+	}
+	rows, err := Summarize(runs, "2102190002", "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if rows[0].StartThreshold != 30 || rows[0].CtOnTime != 2*time.Hour {
+		t.Errorf("expected only the runs of 2102190002, got %+v", rows[0])
+	}
+}